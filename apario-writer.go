@@ -7,6 +7,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"image/color"
 	"log"
 	"os"
 	"os/exec"
@@ -93,6 +94,8 @@ func main() {
 		os.Exit(1)
 	}
 
+	findOptionalBinaries(sl_optional_binaries)
+
 	ex, execErr := os.Getwd()
 	if execErr != nil {
 		panic(execErr)
@@ -101,10 +104,10 @@ func main() {
 	dir_current_directory = filepath.Dir(ex)
 	_ = fmt.Sprintf("Current Working Directory: %s\n", dir_current_directory)
 
-	if *flag_s_download_pdf_url == "" && *flag_s_import_pdf_path == "" &&
-		*flag_s_import_directory == "" && *flag_s_import_csv == "" /* && *flag_s_import_xlsx == ""  */ {
+	if *flag_s_download_pdf_url == "" && *flag_s_import_pdf_path == "" && *flag_s_import_directory == "" &&
+		*flag_s_import_archive == "" && *flag_s_crawl_url == "" && *flag_s_import_csv == "" /* && *flag_s_import_xlsx == ""  */ {
 		flag.Usage()
-		log.Printf("You must use one --download-pdf-url / --import-pdf-path / --import-directory / --import-csv")
+		log.Printf("You must use one --download-pdf-url / --import-pdf-path / --import-directory / --import-archive / --crawl-url / --import-csv")
 		//log.Printf("You must use one --download-pdf-url / --import-pdf-path / --import-directory / --import-csv / --import-xlsx")
 		os.Exit(1)
 	}
@@ -122,6 +125,60 @@ func main() {
 		os.Exit(1)
 	}
 
+	if !validBlankPolicy(*flag_s_blank_policy) {
+		flag.Usage()
+		log.Printf("--blank-policy must be %v, %v or %v but is %q", c_blank_policy_flag, c_blank_policy_skip_ocr, c_blank_policy_skip_all, *flag_s_blank_policy)
+		os.Exit(1)
+	}
+
+	if *flag_b_orientation {
+		hasOSD, osdErr := tesseractHasLanguage("osd")
+		if osdErr != nil {
+			log.Printf("Cannot use --orientation: %v", osdErr)
+			os.Exit(1)
+		}
+		if !hasOSD {
+			log.Printf("Cannot use --orientation without the osd traineddata of tesseract (tesseract-ocr-osd or tesseract-osd)")
+			os.Exit(1)
+		}
+	}
+
+	if renditionErr := load_rendition_profiles(configFile); renditionErr != nil {
+		log.Fatalf("failed to load the rendition profiles: %v", renditionErr)
+	}
+	for _, format := range unavailableFormats() {
+		log.Printf("WARNING: the %v images of --original-formats and the rendition profiles will not be written because its encoder is not installed", format)
+	}
+
+	if httpClientErr := load_http_client(configFile); httpClientErr != nil {
+		log.Fatalf("failed to load the http client: %v", httpClientErr)
+	}
+
+	if trustStoreErr := load_signature_trust_store(*flag_s_trust_store); trustStoreErr != nil {
+		log.Fatalf("failed to load the signature trust store: %v", trustStoreErr)
+	}
+
+	if foreground, err := parseRGB(*flag_s_dark_foreground); err != nil {
+		log.Printf("Ignoring --dark-foreground: %v", err)
+	} else {
+		color_text = foreground
+	}
+
+	if background, err := parseRGB(*flag_s_dark_background); err != nil {
+		log.Printf("Ignoring --dark-background: %v", err)
+	} else {
+		color_background = background
+	}
+
+	sl_dark_palette = []color.RGBA{color_text, color_background}
+	if len(*flag_s_dark_palette) > 0 {
+		if palette, err := parsePalette(*flag_s_dark_palette); err != nil {
+			log.Printf("Ignoring --dark-palette: %v", err)
+		} else {
+			sl_dark_palette = palette
+		}
+	}
+
 	if *flag_i_sem_limiter > 0 {
 		channel_buffer_size = *flag_i_sem_limiter
 	}
@@ -207,6 +264,21 @@ func main() {
 		log_info.Printf("Cryptonyms to search for: %v", out)
 	}
 
+	// load the stop words that are ignored by the keyword analysis
+	stopWordsFile, stopWordsFileErr := fs_references.ReadFile(filepath.Join("bundled", "reference", "stopwords.json"))
+	if stopWordsFileErr != nil {
+		log_error.Printf("failed to read stopwords.json file from the data directory due to error: %v", stopWordsFileErr)
+	} else {
+		var stopWords []string
+		stopWordsMarshalErr := json.Unmarshal(stopWordsFile, &stopWords)
+		if stopWordsMarshalErr != nil {
+			log_error.Printf("failed to load the m_stop_words due to error %v", stopWordsMarshalErr)
+		}
+		for _, word := range stopWords {
+			m_stop_words[word] = true
+		}
+	}
+
 	// which action are we doing?
 	if *flag_s_download_pdf_url != "" && *flag_s_import_pdf_path != "" {
 		flag.Usage()
@@ -230,6 +302,12 @@ func main() {
 	if *flag_s_import_directory != "" {
 		filename = *flag_s_import_directory
 	}
+	if *flag_s_import_archive != "" {
+		filename = *flag_s_import_archive
+	}
+	if *flag_s_crawl_url != "" {
+		filename = *flag_s_crawl_url
+	}
 
 	// TODO: add conditionals for filename for xlsx and csv options
 
@@ -254,9 +332,13 @@ func main() {
 	if *flag_s_download_pdf_url != "" {
 		importErr = process_download_pdf(ctx, *flag_s_download_pdf_url, *flag_s_pdf_metadata_json)
 	} else if *flag_s_import_pdf_path != "" {
-		importErr = process_import_pdf(ctx, *flag_s_import_pdf_path, *flag_s_pdf_metadata_json)
+		importErr = process_import_file(ctx, *flag_s_import_pdf_path, *flag_s_pdf_metadata_json)
 	} else if *flag_s_import_directory != "" {
 		importErr = process_import_directory(ctx, *flag_s_import_directory)
+	} else if *flag_s_import_archive != "" {
+		importErr = process_import_archive(ctx, *flag_s_import_archive, *flag_s_pdf_metadata_json)
+	} else if *flag_s_crawl_url != "" {
+		importErr = process_crawl(ctx, *flag_s_crawl_url, *flag_s_pdf_metadata_json)
 	} else if *flag_s_import_csv != "" {
 		importErr = process_import_csv(ctx, *flag_s_import_csv, process_custom_csv_row)
 	} else if *flag_s_import_xlsx != "" {
@@ -269,6 +351,12 @@ func main() {
 		log_error.Printf("received an error from process_import_csv/process_import_xlsx namely: %v", importErr) // a problem habbened
 	}
 
+	if importErr == nil && a_i_total_documents.Load() == 0 {
+		// every document was skipped as a duplicate or recorded as encrypted_no_password, nothing will reach ch_CompiledDocument
+		log.Printf("no documents were sent into the pipeline")
+		ch_Done <- struct{}{}
+	}
+
 	defer func(logFile *os.File) {
 		err := logFile.Close()
 		if err != nil {
@@ -292,6 +380,9 @@ func main() {
 				if !ok {
 					log_error.Printf("cannot typecast the final result for %s as a .(Document)", d.Identifier)
 				}
+				if err := write_iiif_manifest(d); err != nil {
+					log_error.Tracef("failed to write the IIIF manifest of %v due to error %v", d.Identifier, err)
+				}
 				a_i_received_documents.Add(1)
 				log_info.Printf("a_i_total_documents == a_i_received_documents ; %d == %d",
 					a_i_total_documents.Load(), a_i_received_documents.Load())
@@ -299,6 +390,7 @@ func main() {
 				if a_i_total_documents.Load() == a_i_received_documents.Load() {
 					log.SetOutput(os.Stdout)
 					log.Printf("Completed processing document %v", d)
+					analyze_collection(ctx)
 					ch_Done <- struct{}{}
 				}
 			}
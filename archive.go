@@ -0,0 +1,294 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/ulikunitz/xz"
+)
+
+var ErrUnsafeArchivePath = errors.New("archive entry path is outside of the archive")
+
+// archiveFormat returns the format of the archive at path from its extension, or an empty string when it is not a
+// supported archive
+func archiveFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	for _, format := range []string{".tar.gz", ".tgz", ".tar.xz", ".txz", ".tar", ".zip", ".7z"} {
+		if strings.HasSuffix(name, format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// isImportable returns true for the files that process_import_file can import
+func isImportable(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".pdf") || isOfficeDocument(path) || isEmail(path) || isScanImage(path)
+}
+
+// walk_archive streams the regular files of the archive at path into visit one entry at a time
+func walk_archive(path string, visit func(name string, entry io.Reader) error) error {
+	format := archiveFormat(path)
+	switch format {
+	case ".zip":
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		for _, file := range archive.File {
+			if err := visit_archive_file(path, file.Name, file.Mode(), file.Open, visit); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ".7z":
+		archive, err := sevenzip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		for _, file := range archive.File {
+			if err := visit_archive_file(path, file.Name, file.Mode(), file.Open, visit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var stream io.Reader = file
+	switch format {
+	case ".tar.gz", ".tgz":
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		stream = gz
+	case ".tar.xz", ".txz":
+		stream, err = xz.NewReader(file)
+		if err != nil {
+			return err
+		}
+	case ".tar":
+	default:
+		return fmt.Errorf("unsupported archive %v", path)
+	}
+	archive := tar.NewReader(stream)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %v due to error %v", path, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(header.Name, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// visit_archive_file opens the entry called name of the zip or 7z archive at path and passes it to visit when it is a
+// regular file
+func visit_archive_file(path, name string, mode fs.FileMode, open func() (io.ReadCloser, error), visit func(name string, entry io.Reader) error) error {
+	if !mode.IsRegular() {
+		return nil
+	}
+	entry, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to open %v in %v due to error %v", name, path, err)
+	}
+	err = visit(name, entry)
+	_ = entry.Close()
+	return err
+}
+
+// extract_archive_entry writes entry to its name inside dir, refusing the names that would escape dir (zip-slip)
+func extract_archive_entry(dir, name string, entry io.Reader) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%w: %v", ErrUnsafeArchivePath, name)
+	}
+	target := filepath.Join(dir, local)
+	if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, entry)
+	close_err := file.Close()
+	if err == nil {
+		err = close_err
+	}
+	if err == nil {
+		err = safe_path_check(target, dir)
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return "", err
+	}
+	return target, nil
+}
+
+// archive_metadata describes where name is inside archive: the first directory of the path is the box, the last
+// directory is the folder. "Box 12/Folder 3/memo.pdf" has the box "Box 12", the folder "Folder 3" and the filename
+// "memo.pdf"
+func archive_metadata(archive, name string) map[string]string {
+	metadata := map[string]string{
+		"archive":      filepath.Base(archive),
+		"archive_path": name,
+		"filename":     path.Base(name),
+	}
+	dir := path.Dir(strings.TrimSuffix(name, "/"))
+	if dir == "." || dir == "/" {
+		return metadata
+	}
+	dirs := strings.Split(strings.Trim(dir, "/"), "/")
+	metadata["folder"] = dirs[len(dirs)-1]
+	if len(dirs) > 1 {
+		metadata["box"] = dirs[0]
+	}
+	return metadata
+}
+
+// merge_metadata_json merges the metadata of an entry into the --metadata-json it was imported with
+func merge_metadata_json(metadata map[string]string, entry map[string]string) (string, error) {
+	merged := make(map[string]string, len(metadata)+len(entry))
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	for key, value := range entry {
+		merged[key] = value
+	}
+	data, err := json.Marshal(merged)
+	return string(data), err
+}
+
+// process_import_archive streams the entries of a zip, 7z, tar, tar.gz or tar.xz archive and imports every PDF, office
+// document and scanned image in it with the path of the entry as metadata. Each entry is written to disk only while
+// it is imported, except the scanned images that are kept until the archive is read so the images of each directory
+// are imported as one document
+func process_import_archive(ctx context.Context, archive string, metadata_json string) error {
+	archive, err := filepath.Abs(archive)
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	metadata := make(map[string]string)
+	if len(metadata_json) > 0 {
+		if err := json.Unmarshal([]byte(metadata_json), &metadata); err != nil {
+			log_debug.Tracef("failed to parse the --metadata-json due to err %v", err)
+		}
+	}
+
+	workDir, err := os.MkdirTemp("", "apario-archive-")
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	defer os.RemoveAll(workDir)
+	workDir, err = filepath.EvalSymlinks(workDir)
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+
+	// the archive holds a place in a_i_total_documents until every entry was imported so the pipeline cannot finish
+	// between two entries, the way ReceiveRows counts the rows of a spreadsheet before they are imported
+	a_i_total_documents.Add(1)
+	defer a_i_total_documents.Add(-1)
+
+	images := make(map[string][]string) // directory inside the archive => extracted images
+	entries := make(map[string]string)  // extracted image => entry name
+	err = walk_archive(archive, func(name string, entry io.Reader) error {
+		if !isImportable(name) {
+			log_info.Printf("skipping %v in %v because it is not a pdf, office document, email or scanned image", name, archive)
+			return nil
+		}
+		target, extract_err := extract_archive_entry(workDir, name, entry)
+		if extract_err != nil {
+			log_error.Tracef("failed to extract %v from %v due to err %v", name, archive, extract_err)
+			return nil
+		}
+		if isScanImage(name) {
+			images[path.Dir(name)] = append(images[path.Dir(name)], target)
+			entries[target] = name
+			return nil
+		}
+		defer os.Remove(target)
+
+		entry_json, json_err := merge_metadata_json(metadata, archive_metadata(archive, name))
+		if json_err != nil {
+			return json_err
+		}
+		entry_ctx := context.WithValue(ctx, CtxKey("record_source"), archive+"!/"+name)
+		if import_err := process_import_file(entry_ctx, target, entry_json); import_err != nil {
+			log_error.Tracef("failed to import %v from %v due to err %v", name, archive, import_err)
+		}
+		return nil
+	})
+	if err != nil {
+		return log_error.TraceReturnf("failed to read the archive %v due to err %v", archive, err)
+	}
+
+	for dir, paths := range images {
+		for _, sources := range scanDocuments(paths) {
+			entry := archive_metadata(archive, entries[sources[0]])
+			name, origin := path.Base(dir), archive+"!/"+dir
+			if dir == "." {
+				name = strings.TrimSuffix(filepath.Base(archive), archiveFormat(archive))
+			}
+			if len(sources) == 1 {
+				name, origin = filepath.Base(sources[0]), archive+"!/"+entries[sources[0]]
+			} else {
+				entry["archive_path"] = dir
+				delete(entry, "filename")
+			}
+			entry_json, json_err := merge_metadata_json(metadata, entry)
+			if json_err != nil {
+				return log_error.TraceReturn(json_err)
+			}
+			if import_err := process_import_images(ctx, name, sources, origin, entry_json); import_err != nil {
+				log_error.Tracef("failed to import the images %v from %v due to err %v", sources, archive, import_err)
+			}
+		}
+	}
+	return nil
+}
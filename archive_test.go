@@ -0,0 +1,203 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/ulikunitz/xz"
+)
+
+var testArchiveEntries = []struct{ name, body string }{
+	{"Box 1/Folder 2/memo.pdf", "memo"},
+	{"readme.txt", "readme"},
+	{"../escape.pdf", "escape"},
+}
+
+// writeTestArchive writes testArchiveEntries into an archive of the format at path
+func writeTestArchive(t *testing.T, path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if archiveFormat(path) == ".7z" {
+		writeTest7z(t, file)
+		return
+	}
+	if archiveFormat(path) == ".zip" {
+		archive := zip.NewWriter(file)
+		for _, entry := range testArchiveEntries {
+			w, err := archive.Create(entry.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = w.Write([]byte(entry.body))
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	var stream io.WriteCloser
+	switch archiveFormat(path) {
+	case ".tar.gz":
+		stream = gzip.NewWriter(file)
+	case ".tar.xz":
+		if stream, err = xz.NewWriter(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := tar.NewWriter(stream)
+	_ = archive.WriteHeader(&tar.Header{Name: "Box 1/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, entry := range testArchiveEntries {
+		_ = archive.WriteHeader(&tar.Header{Name: entry.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(entry.body))})
+		_, _ = archive.Write([]byte(entry.body))
+	}
+	_ = archive.WriteHeader(&tar.Header{Name: "link.pdf", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTest7z writes testArchiveEntries into file as a 7z archive whose single folder stores them with the copy method
+func writeTest7z(t *testing.T, file io.Writer) {
+	number := func(value int) []byte {
+		if value < 0x80 {
+			return []byte{byte(value)}
+		}
+		if value >= 0x4000 {
+			t.Fatalf("writeTest7z() cannot encode %d", value)
+		}
+		return []byte{0x80 | byte(value>>8), byte(value)}
+	}
+
+	var packed, names []byte
+	var sizes []int
+	for _, entry := range testArchiveEntries {
+		packed = append(packed, entry.body...)
+		sizes = append(sizes, len(entry.body))
+		for _, r := range utf16.Encode([]rune(entry.name)) {
+			names = binary.LittleEndian.AppendUint16(names, r)
+		}
+		names = append(names, 0, 0)
+	}
+
+	var header []byte
+	header = append(header, 0x01, 0x04)                                                           // header, main streams info
+	header = append(append(append(header, 0x06, 0x00, 0x01, 0x09), number(len(packed))...), 0x00) // pack info
+	header = append(header, 0x07, 0x0b, 0x01, 0x00, 0x01, 0x01, 0x00, 0x0c)                       // one folder of one copy coder
+	header = append(append(header, number(len(packed))...), 0x00)
+	header = append(append(header, 0x08, 0x0d), number(len(sizes))...) // substreams info
+	header = append(header, 0x09)
+	for _, size := range sizes[:len(sizes)-1] {
+		header = append(header, number(size)...)
+	}
+	header = append(header, 0x00, 0x00)
+	header = append(append(header, 0x05), number(len(testArchiveEntries))...) // files info
+	header = append(append(append(header, 0x11), number(len(names)+1)...), 0x00)
+	header = append(append(header, names...), 0x00, 0x00)
+
+	start := make([]byte, 20)
+	binary.LittleEndian.PutUint64(start[0:], uint64(len(packed)))
+	binary.LittleEndian.PutUint64(start[8:], uint64(len(header)))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(header))
+	signature := []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04}
+	signature = binary.LittleEndian.AppendUint32(signature, crc32.ChecksumIEEE(start))
+	for _, part := range [][]byte{signature, start, packed, header} {
+		if _, err := file.Write(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_walk_archive(t *testing.T) {
+	for _, name := range []string{"release.zip", "release.7z", "release.tar.gz", "release.tar.xz"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, name)
+			writeTestArchive(t, path)
+
+			extractDir := filepath.Join(dir, "extracted")
+			if err := os.Mkdir(extractDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			var extracted []string
+			err := walk_archive(path, func(name string, entry io.Reader) error {
+				target, err := extract_archive_entry(extractDir, name, entry)
+				if name == "../escape.pdf" {
+					if !errors.Is(err, ErrUnsafeArchivePath) {
+						t.Errorf("extract_archive_entry(%v) = %v, %v, want ErrUnsafeArchivePath", name, target, err)
+					}
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				extracted = append(extracted, target)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walk_archive() error = %v", err)
+			}
+			want := []string{filepath.Join(extractDir, "Box 1", "Folder 2", "memo.pdf"), filepath.Join(extractDir, "readme.txt")}
+			if !reflect.DeepEqual(extracted, want) {
+				t.Errorf("walk_archive() extracted %v, want %v", extracted, want)
+			}
+			if data, err := os.ReadFile(want[0]); err != nil || string(data) != "memo" {
+				t.Errorf("extract_archive_entry() wrote %q, %v, want memo", data, err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "escape.pdf")); !os.IsNotExist(err) {
+				t.Errorf("extract_archive_entry() wrote outside of the extract directory")
+			}
+		})
+	}
+}
+
+func Test_archive_metadata(t *testing.T) {
+	tests := []struct {
+		name string
+		want map[string]string
+	}{
+		{"Box 12/Folder 3/memo.pdf", map[string]string{"archive": "release.zip", "archive_path": "Box 12/Folder 3/memo.pdf", "filename": "memo.pdf", "box": "Box 12", "folder": "Folder 3"}},
+		{"Folder 3/memo.pdf", map[string]string{"archive": "release.zip", "archive_path": "Folder 3/memo.pdf", "filename": "memo.pdf", "folder": "Folder 3"}},
+		{"memo.pdf", map[string]string{"archive": "release.zip", "archive_path": "memo.pdf", "filename": "memo.pdf"}},
+	}
+	for _, tt := range tests {
+		if got := archive_metadata("/data/release.zip", tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("archive_metadata(%v) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if archiveFormat("release.TGZ") != ".tgz" || archiveFormat("release.tar.xz") != ".tar.xz" || archiveFormat("release.7z") != ".7z" {
+		t.Errorf("archiveFormat() did not recognize the archive extensions")
+	}
+}
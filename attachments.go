@@ -0,0 +1,107 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// describe_pdf_contents saves the outline of rd.PDFPath as its table of contents and imports the PDFs embedded in it as
+// child documents; it runs before rd is written and sent into ch_ImportedRow so the children are counted before the
+// parent can complete
+func describe_pdf_contents(ctx context.Context, rd ResultData) ResultData {
+	toc, toc_err := pdf_table_of_contents(rd.PDFPath)
+	if toc_err != nil {
+		log_error.Tracef("failed to read the table of contents of %v due to err %v", rd.PDFPath, toc_err)
+	} else {
+		rd.TableOfContents = toc
+	}
+	return import_pdf_attachments(ctx, rd)
+}
+
+// import_pdf_attachments extracts the embedded files of rd.PDFPath into <DataDir>/attachments and imports each PDF,
+// office document, email or scanned image among them with process_import_file as a child document of rd
+func import_pdf_attachments(ctx context.Context, rd ResultData) ResultData {
+	depth, _ := ctx.Value(CtxKey("attachment_depth")).(int)
+	if depth >= c_attachment_depth {
+		return rd
+	}
+	attachments, extract_err := extract_pdf_attachments(rd.PDFPath, filepath.Join(rd.DataDir, "attachments"))
+	if extract_err != nil {
+		log_error.Tracef("failed to extract the attachments of %v due to err %v", rd.PDFPath, extract_err)
+	}
+	if len(attachments) == 0 {
+		return rd
+	}
+
+	ctx = context.WithValue(ctx, CtxKey("parent_identifier"), rd.Identifier)
+	ctx = context.WithValue(ctx, CtxKey("parent_record_path"), rd.RecordPath)
+	ctx = context.WithValue(ctx, CtxKey("attachment_depth"), depth+1)
+	ctx = context.WithValue(ctx, CtxKey("sources"), []string(nil)) // the sources belong to the parent
+	ctx = context.WithValue(ctx, CtxKey("publisher_checksum"), "") // so does the checksum of its publisher
+	ctx = context.WithValue(ctx, CtxKey("source_checksum"), (*PublisherChecksum)(nil))
+	for i, attachment := range attachments {
+		if !isImportable(attachment.Path) {
+			continue // the other files are kept in the attachments directory
+		}
+		metadata := map[string]string{"attachment": attachment.FileName}
+		if len(attachment.Description) > 0 {
+			metadata["description"] = attachment.Description
+		}
+		metadata_json, marshal_err := json.Marshal(metadata)
+		if marshal_err != nil {
+			log_error.Tracef("failed to marshal the metadata of attachment %v due to err %v", attachment.Path, marshal_err)
+			continue
+		}
+		log_info.Printf("importing attachment %v of %v as a child document", attachment.FileName, rd.Identifier)
+		child_ctx := context.WithValue(ctx, CtxKey("record_source"), attachment.Path)
+		import_err := process_import_file(child_ctx, attachment.Path, string(metadata_json))
+		if import_err != nil {
+			log_error.Tracef("failed to import attachment %v due to err %v", attachment.Path, import_err)
+			continue
+		}
+		record_path := filepath.Join(*flag_s_database_directory, Sha256(attachment.Path), "record.json")
+		if _, stat_err := os.Stat(record_path); stat_err == nil { // the messages of an mbox have a record each
+			attachments[i].RecordPath = record_path
+		}
+	}
+	rd.Attachments = attachments
+	return rd
+}
+
+// attachment_filename returns the name that the attachment number i (counting from 0) called name is written as:
+// its sanitized base name, attachment_<number> when it has no usable name, prefixed by its number when an earlier
+// attachment in taken already used it
+func attachment_filename(i int, name string, taken map[string]bool) string {
+	filename := filepath.Base(api.SanitizePath(name))
+	if base := filepath.Base(strings.TrimSpace(name)); base == "." || base == ".." || base == string(filepath.Separator) {
+		filename = fmt.Sprintf("attachment_%d", i+1)
+	}
+	if taken[filename] {
+		filename = fmt.Sprintf("%d_%v", i+1, filename)
+	}
+	taken[filename] = true
+	return filename
+}
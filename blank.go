@@ -0,0 +1,109 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"image"
+	"math"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	c_blank_policy_flag     = "flag"     // only record the blank flag in the manifest
+	c_blank_policy_skip_ocr = "skip-ocr" // do not run tesseract on blank pages
+	c_blank_policy_skip_all = "skip-all" // do not generate thumbnails or run tesseract on blank pages
+
+	c_blank_step_ocr        = "ocr"
+	c_blank_step_thumbnails = "thumbnails"
+
+	c_ink_luminance = 128  // pixels darker than this are ink
+	c_ink_margin    = 0.05 // scanner shadows along the edges are ignored
+)
+
+// measureInkCoverage returns the fraction (0.0-1.0) of pixels inside the margins of img that are darker than
+// c_ink_luminance; every other pixel of every other row is sampled
+func measureInkCoverage(img image.Image) float64 {
+	bounds := img.Bounds()
+	marginX := int(float64(bounds.Dx()) * c_ink_margin)
+	marginY := int(float64(bounds.Dy()) * c_ink_margin)
+	var ink, total int
+	for y := bounds.Min.Y + marginY; y < bounds.Max.Y-marginY; y += 2 {
+		for x := bounds.Min.X + marginX; x < bounds.Max.X-marginX; x += 2 {
+			r, g, b, _ := img.At(x, y).RGBA()
+			luminance := (299*r + 587*g + 114*b) / 1000 >> 8
+			if luminance < c_ink_luminance {
+				ink++
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(ink) / float64(total)
+}
+
+// detectBlankPage measures the ink coverage of pp.PNG.Light[c_rendition_original] and flags the page as blank when the
+// coverage is below --blank-threshold
+func detectBlankPage(pp PendingPage) PendingPage {
+	file, err := os.Open(pp.PNG.Light[c_rendition_original])
+	if err != nil {
+		log_error.Tracef("failed to open %v to detect a blank page due to error %v", pp.PNG.Light[c_rendition_original], err)
+		return pp
+	}
+	defer file.Close()
+	img, err := imaging.Decode(file)
+	if err != nil {
+		log_error.Tracef("failed to decode %v to detect a blank page due to error %v", pp.PNG.Light[c_rendition_original], err)
+		return pp
+	}
+	coverage := measureInkCoverage(img)
+	pp.InkCoverage = math.Round(coverage*1e6) / 1e6
+	pp.Blank = coverage < *flag_f_blank_threshold
+	if pp.Blank {
+		log_info.Printf("page %d of %v is blank with %.4f%% ink coverage (--blank-policy %v)", pp.PageNumber, pp.RecordIdentifier, coverage*100, *flag_s_blank_policy)
+	}
+	return pp
+}
+
+// validBlankPolicy returns true when policy is one of the values that --blank-policy accepts
+func validBlankPolicy(policy string) bool {
+	switch policy {
+	case c_blank_policy_flag, c_blank_policy_skip_ocr, c_blank_policy_skip_all:
+		return true
+	default:
+		return false
+	}
+}
+
+// skipBlankPage returns true when the --blank-policy excludes a blank page from the step
+func skipBlankPage(pp PendingPage, step string) bool {
+	if !pp.Blank {
+		return false
+	}
+	switch *flag_s_blank_policy {
+	case c_blank_policy_skip_all:
+		return true
+	case c_blank_policy_skip_ocr:
+		return step == c_blank_step_ocr
+	default:
+		return false
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testInkPage returns a white page whose pixels are darkened by up to noise and that has rows of text-like ink
+func testInkPage(rows int, noise uint8) *image.Gray {
+	page := image.NewGray(image.Rect(0, 0, 400, 520))
+	seed := uint32(3)
+	for i := range page.Pix {
+		page.Pix[i] = 255
+		if noise > 0 {
+			seed = seed*1664525 + 1013904223
+			page.Pix[i] -= uint8(seed>>24) % noise
+		}
+	}
+	for row := 0; row < rows; row++ {
+		for y := 60 + row*20; y < 70+row*20; y++ {
+			for x := 60; x < 340; x++ {
+				if (x/6)%4 != 3 { // words separated by spaces
+					page.SetGray(x, y, color.Gray{Y: 20})
+				}
+			}
+		}
+	}
+	return page
+}
+
+func Test_measureInkCoverage(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     image.Image
+		min, max float64
+	}{
+		{"white", testInkPage(0, 0), 0, 0},
+		{"near-white with scanner noise", testInkPage(0, 96), 0, 0},
+		{"one line of text", testInkPage(1, 0), 0.005, 0.03},
+		{"page of text", testInkPage(20, 64), 0.2, 0.5},
+	}
+	for _, tt := range tests {
+		if coverage := measureInkCoverage(tt.page); coverage < tt.min || coverage > tt.max {
+			t.Errorf("measureInkCoverage(%v) = %v, want between %v and %v", tt.name, coverage, tt.min, tt.max)
+		}
+	}
+
+	// dark scanner shadows along the edges are inside the margins
+	shadow := testInkPage(0, 0)
+	for y := 0; y < 520; y++ {
+		for x := 0; x < 15; x++ {
+			shadow.SetGray(x, y, color.Gray{Y: 0})
+		}
+	}
+	if coverage := measureInkCoverage(shadow); coverage != 0 {
+		t.Errorf("measureInkCoverage(shadow) = %v, want 0", coverage)
+	}
+}
+
+func Test_detectBlankPage(t *testing.T) {
+	info := log_info
+	log_info = NewCustomLogger(io.Discard, "", 0, 1)
+	t.Cleanup(func() { log_info = info })
+
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		page  image.Image
+		blank bool
+	}{
+		{"white", testInkPage(0, 0), true},
+		{"near-white", testInkPage(0, 96), true},
+		{"text", testInkPage(3, 32), false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".png")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(file, tt.page); err != nil {
+			t.Fatal(err)
+		}
+		_ = file.Close()
+
+		var pp PendingPage
+		pp.PNG.Light = Images{c_rendition_original: path}
+		pp = detectBlankPage(pp)
+		if pp.Blank != tt.blank {
+			t.Errorf("detectBlankPage(%v).Blank = %v (%v ink coverage), want %v", tt.name, pp.Blank, pp.InkCoverage, tt.blank)
+		}
+	}
+}
+
+func Test_validBlankPolicy(t *testing.T) {
+	for _, policy := range []string{c_blank_policy_flag, c_blank_policy_skip_ocr, c_blank_policy_skip_all} {
+		if !validBlankPolicy(policy) {
+			t.Errorf("validBlankPolicy(%q) = false", policy)
+		}
+	}
+	for _, policy := range []string{"skip_ocr", "", "SKIP-ALL"} {
+		if validBlankPolicy(policy) {
+			t.Errorf("validBlankPolicy(%q) = true", policy)
+		}
+	}
+}
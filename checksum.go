@@ -0,0 +1,197 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrChecksumMismatch     = errors.New("file does not match the checksum of its publisher")
+	ErrChecksumUnverifiable = errors.New("file cannot be verified against the checksum of its publisher")
+)
+
+const (
+	c_checksum_policy_reject     = "reject"     // delete the file and skip the row
+	c_checksum_policy_quarantine = "quarantine" // move the file into the quarantine directory of its record
+)
+
+// m_checksum_algorithms correlates the length of a hex encoded checksum to the algorithm that produced it
+var m_checksum_algorithms = map[int]string{
+	md5.Size * 2:    "md5",
+	sha256.Size * 2: "sha256",
+	sha512.Size * 2: "sha512",
+}
+
+// parse_publisher_checksum returns the algorithm and the lowercase hex digest of a checksum column value such as
+// "9e107d9d372bb6826bd81d3542a419d6" or "SHA256:2C26B46B..."; the algorithm is detected by the length of the digest
+func parse_publisher_checksum(value string) (algorithm string, digest string, err error) {
+	digest = strings.ToLower(strings.TrimSpace(value))
+	prefix := ""
+	if i := strings.IndexAny(digest, ":="); i > 0 {
+		prefix, digest = strings.ReplaceAll(strings.TrimSpace(digest[:i]), "-", ""), strings.TrimSpace(digest[i+1:])
+	}
+	digest = strings.Join(strings.Fields(digest), "")
+	if _, hex_err := hex.DecodeString(digest); hex_err != nil || len(digest) == 0 {
+		return "", "", fmt.Errorf("checksum %q is not hex encoded", value)
+	}
+	algorithm, ok := m_checksum_algorithms[len(digest)]
+	if !ok {
+		return "", "", fmt.Errorf("checksum %q is not an md5, sha256 or sha512 digest", value)
+	}
+	if len(prefix) > 0 && prefix != algorithm {
+		return "", "", fmt.Errorf("checksum %q is labelled %v but is as long as a %v digest", value, prefix, algorithm)
+	}
+	return algorithm, digest, nil
+}
+
+// verify_publisher_checksum compares the file at path to the expected checksum of its publisher; when the checksum
+// cannot be compared the unverified result carries the reason next to the error
+func verify_publisher_checksum(path string, expected string) (*PublisherChecksum, error) {
+	algorithm, digest, err := parse_publisher_checksum(expected)
+	if err != nil {
+		return &PublisherChecksum{Expected: strings.TrimSpace(expected), Reason: err.Error()}, err
+	}
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		h = sha512.New()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return &PublisherChecksum{Algorithm: algorithm, Expected: digest, Reason: err.Error()}, err
+	}
+	defer file.Close()
+	sem_shafile.Acquire()
+	_, err = io.Copy(h, file)
+	sem_shafile.Release()
+	if err != nil {
+		return &PublisherChecksum{Algorithm: algorithm, Expected: digest, Reason: err.Error()}, err
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	return &PublisherChecksum{
+		Algorithm: algorithm,
+		Expected:  digest,
+		Actual:    actual,
+		Verified:  actual == digest,
+	}, nil
+}
+
+// quarantine_path moves the file at path into the quarantine directory of recordDir and returns its new path
+func quarantine_path(recordDir string, path string) (string, error) {
+	dir := filepath.Join(recordDir, "quarantine")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return path, err
+	}
+	destination := filepath.Join(dir, filepath.Base(path))
+	if err := os.Rename(path, destination); err != nil {
+		return path, err
+	}
+	return destination, nil
+}
+
+// check_publisher_checksum verifies rd.PDFPath against the checksum that the import row placed into ctx; a file
+// without one is not verified. A file that does not match, or whose checksum cannot be compared (an unsupported
+// algorithm, malformed hex or a read error), is handled with --checksum-policy and returns ErrChecksumMismatch or
+// ErrChecksumUnverifiable so the file is never sent into ch_ImportedRow
+func check_publisher_checksum(ctx context.Context, rd ResultData) (*PublisherChecksum, error) {
+	expected, _ := ctx.Value(CtxKey("publisher_checksum")).(string)
+	if len(strings.TrimSpace(expected)) == 0 {
+		return nil, nil
+	}
+	verification, err := verify_publisher_checksum(rd.PDFPath, expected)
+	if err != nil {
+		unverifiable := fmt.Errorf("%w: %v: %v", ErrChecksumUnverifiable, rd.PDFPath, err)
+		return verification, reject_or_quarantine(rd, verification, c_status_checksum_unverifiable, unverifiable)
+	}
+	if verification.Verified {
+		log_debug.Printf("verified %v against the %v checksum of its publisher", rd.PDFPath, verification.Algorithm)
+		return verification, nil
+	}
+
+	verification.Reason = fmt.Sprintf("the %v checksum is %v", verification.Algorithm, verification.Actual)
+	mismatch := fmt.Errorf("%w: %v has the %v checksum %v instead of %v", ErrChecksumMismatch, rd.PDFPath, verification.Algorithm, verification.Actual, verification.Expected)
+	return verification, reject_or_quarantine(rd, verification, c_status_checksum_mismatch, mismatch)
+}
+
+// check_source_checksum verifies the source document of a converted PDF, such as an office document or an email, against
+// the checksum that the import row placed into ctx before it is converted; pdf is the path that process_import_pdf will
+// import the converted PDF from so a quarantined source is kept in the record of that PDF. The returned ctx carries the
+// verification to process_import_pdf in place of the checksum, which is of the source and not of the PDF
+func check_source_checksum(ctx context.Context, source string, pdf string) (context.Context, error) {
+	expected, _ := ctx.Value(CtxKey("publisher_checksum")).(string)
+	if len(strings.TrimSpace(expected)) == 0 {
+		return ctx, nil
+	}
+	recordDir := filepath.Join(*flag_s_database_directory, import_record_checksum(ctx, pdf))
+	verification, err := check_publisher_checksum(ctx, ResultData{
+		Identifier:  NewIdentifier(6),
+		DataDir:     recordDir,
+		URLChecksum: filepath.Base(recordDir),
+		PDFPath:     source,
+		RecordPath:  filepath.Join(recordDir, "record.json"),
+	})
+	ctx = context.WithValue(ctx, CtxKey("publisher_checksum"), "")
+	return context.WithValue(ctx, CtxKey("source_checksum"), verification), err
+}
+
+// reject_or_quarantine applies --checksum-policy to the file of rd that failed its verification and returns err; a
+// quarantined file has its record.json saved with status and the verification
+func reject_or_quarantine(rd ResultData, verification *PublisherChecksum, status string, err error) error {
+	if *flag_s_checksum_policy != c_checksum_policy_quarantine {
+		if remove_err := os.Remove(rd.PDFPath); remove_err != nil && !os.IsNotExist(remove_err) {
+			log_error.Tracef("cannot remove %v due to err %v", rd.PDFPath, remove_err)
+		}
+		return err
+	}
+
+	quarantined, quarantine_err := quarantine_path(rd.DataDir, rd.PDFPath)
+	if quarantine_err != nil && !os.IsNotExist(quarantine_err) {
+		log_error.Tracef("cannot quarantine %v due to err %v", rd.PDFPath, quarantine_err)
+		return err
+	}
+	log_info.Printf("quarantined %v at %v: %v", rd.PDFPath, quarantined, err)
+	rd.PDFPath = quarantined
+	rd.PublisherChecksum = verification
+	rd.Status = status
+	if file, open_err := os.Open(quarantined); open_err == nil {
+		rd.PDFChecksum = FileSha512(file)
+		_ = file.Close()
+	}
+	if write_err := WriteResultDataToJson(rd); write_err != nil {
+		log_error.Tracef("cannot write %v due to err %v", rd.RecordPath, write_err)
+	}
+	return err
+}
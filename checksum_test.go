@@ -0,0 +1,216 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parse_publisher_checksum(t *testing.T) {
+	tests := []struct {
+		value     string
+		algorithm string
+		digest    string
+		wantErr   bool
+	}{
+		{"9E107D9D372BB6826BD81D3542A419D6", "md5", "9e107d9d372bb6826bd81d3542a419d6", false},
+		{"sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", "sha256", "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", false},
+		{" SHA-256 = d7a8fbb3 07d78094 69ca9abc b0082e4f 8d5651e4 6d3cdb76 2d02d0bf 37c9e592 ", "sha256", "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", false},
+		{"md5:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", "", "", true},
+		{"2fd4e1c67a2d28fced849ee1bb76e7391b93eb12", "", "", true},
+		{"not a checksum", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		algorithm, digest, err := parse_publisher_checksum(tt.value)
+		if (err != nil) != tt.wantErr || algorithm != tt.algorithm || digest != tt.digest {
+			t.Errorf("parse_publisher_checksum(%q) = %v, %v, %v, want %v, %v, error %v", tt.value, algorithm, digest, err, tt.algorithm, tt.digest, tt.wantErr)
+		}
+	}
+}
+
+func Test_verify_publisher_checksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "memo.pdf")
+	if err := os.WriteFile(path, []byte("The quick brown fox jumps over the lazy dog"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"9e107d9d372bb6826bd81d3542a419d6",
+		"d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592",
+		"07e547d9586f6a73f73fbac0435ed76951218fb7d0c8d788a309d785436bbb642e93a252a954f23912547d1e8a3b5ed6e1bfd7097821233fa0538f3db854fee6",
+	} {
+		verification, err := verify_publisher_checksum(path, expected)
+		if err != nil || !verification.Verified || verification.Actual != expected {
+			t.Errorf("verify_publisher_checksum(%v) = %+v, %v, want verified", expected, verification, err)
+		}
+	}
+
+	verification, err := verify_publisher_checksum(path, "e4d909c290d0fb1ca068ffaddf22cbd0")
+	if err != nil || verification.Verified || verification.Algorithm != "md5" || verification.Actual != "9e107d9d372bb6826bd81d3542a419d6" {
+		t.Errorf("verify_publisher_checksum(mismatch) = %+v, %v, want an unverified md5", verification, err)
+	}
+	verification, err = verify_publisher_checksum(filepath.Join(dir, "missing.pdf"), "9e107d9d372bb6826bd81d3542a419d6")
+	if err == nil || verification == nil || verification.Verified || verification.Algorithm != "md5" || len(verification.Reason) == 0 {
+		t.Errorf("verify_publisher_checksum(missing) = %+v, %v, want an unverified md5 with a reason", verification, err)
+	}
+	// SHA-1 is not accepted from publishers
+	verification, err = verify_publisher_checksum(path, "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12")
+	if err == nil || verification == nil || verification.Verified || len(verification.Reason) == 0 {
+		t.Errorf("verify_publisher_checksum(sha1) = %+v, %v, want an unverified checksum with a reason", verification, err)
+	}
+}
+
+func Test_quarantine_path(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "memo.pdf")
+	if err := os.WriteFile(path, testPDF(1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	quarantined, err := quarantine_path(dir, path)
+	if err != nil || quarantined != filepath.Join(dir, "quarantine", "memo.pdf") {
+		t.Fatalf("quarantine_path() = %v, %v", quarantined, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("quarantine_path() left %v in place", path)
+	}
+	if _, err := os.Stat(quarantined); err != nil {
+		t.Errorf("quarantine_path() did not move the file: %v", err)
+	}
+}
+
+func Test_check_publisher_checksum(t *testing.T) {
+	for _, logger := range []**CustomLogger{&log_error, &log_info, &log_debug} {
+		previous := *logger
+		*logger = NewCustomLogger(io.Discard, "", 0, 1)
+		t.Cleanup(func() { *logger = previous })
+	}
+	defer func(policy string) { *flag_s_checksum_policy = policy }(*flag_s_checksum_policy)
+
+	tests := []struct {
+		name     string
+		policy   string
+		expected string
+		err      error
+		status   string
+	}{
+		{"no checksum", c_checksum_policy_reject, "", nil, ""},
+		{"verified", c_checksum_policy_reject, "9e107d9d372bb6826bd81d3542a419d6", nil, ""},
+		{"rejected mismatch", c_checksum_policy_reject, "e4d909c290d0fb1ca068ffaddf22cbd0", ErrChecksumMismatch, ""},
+		{"rejected unverifiable", c_checksum_policy_reject, "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12", ErrChecksumUnverifiable, ""},
+		{"quarantined mismatch", c_checksum_policy_quarantine, "e4d909c290d0fb1ca068ffaddf22cbd0", ErrChecksumMismatch, c_status_checksum_mismatch},
+		{"quarantined unverifiable", c_checksum_policy_quarantine, "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12", ErrChecksumUnverifiable, c_status_checksum_unverifiable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*flag_s_checksum_policy = tt.policy
+			dir := t.TempDir()
+			rd := ResultData{
+				Identifier: "memo01",
+				DataDir:    dir,
+				PDFPath:    filepath.Join(dir, "memo.pdf"),
+				RecordPath: filepath.Join(dir, "record.json"),
+			}
+			if err := os.WriteFile(rd.PDFPath, []byte("The quick brown fox jumps over the lazy dog"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.WithValue(context.Background(), CtxKey("publisher_checksum"), tt.expected)
+			verification, err := check_publisher_checksum(ctx, rd)
+			if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+				t.Fatalf("check_publisher_checksum() error = %v, want %v", err, tt.err)
+			}
+			if len(tt.expected) == 0 {
+				if verification != nil {
+					t.Errorf("check_publisher_checksum() = %+v, want no verification", verification)
+				}
+				return
+			}
+			if verification == nil || verification.Verified != (tt.err == nil) || (tt.err != nil && len(verification.Reason) == 0) {
+				t.Errorf("check_publisher_checksum() = %+v", verification)
+			}
+
+			_, kept := os.Stat(rd.PDFPath)
+			_, quarantined := os.Stat(filepath.Join(dir, "quarantine", "memo.pdf"))
+			record, record_err := read_result_data(rd.RecordPath)
+			switch {
+			case tt.err == nil:
+				if kept != nil || record_err == nil {
+					t.Errorf("check_publisher_checksum() did not leave the verified file alone")
+				}
+			case tt.policy == c_checksum_policy_reject:
+				if !os.IsNotExist(kept) || quarantined == nil || record_err == nil {
+					t.Errorf("check_publisher_checksum() did not delete the rejected file")
+				}
+			default:
+				if !os.IsNotExist(kept) || quarantined != nil {
+					t.Errorf("check_publisher_checksum() did not move the file into quarantine")
+				}
+				if record_err != nil || record.Status != tt.status || record.PublisherChecksum == nil || record.PDFPath != filepath.Join(dir, "quarantine", "memo.pdf") {
+					t.Errorf("check_publisher_checksum() saved %+v, %v, want status %v", record, record_err, tt.status)
+				}
+			}
+		})
+	}
+}
+
+func Test_check_source_checksum(t *testing.T) {
+	for _, logger := range []**CustomLogger{&log_error, &log_info, &log_debug} {
+		previous := *logger
+		*logger = NewCustomLogger(io.Discard, "", 0, 1)
+		t.Cleanup(func() { *logger = previous })
+	}
+	defer func(dir string, policy string) {
+		*flag_s_database_directory, *flag_s_checksum_policy = dir, policy
+	}(*flag_s_database_directory, *flag_s_checksum_policy)
+	*flag_s_database_directory = t.TempDir()
+	*flag_s_checksum_policy = c_checksum_policy_reject
+
+	workDir := t.TempDir()
+	source := filepath.Join(workDir, "memo.docx")
+	if err := os.WriteFile(source, []byte("The quick brown fox jumps over the lazy dog"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pdf := source + ".pdf"
+
+	ctx := context.WithValue(context.Background(), CtxKey("publisher_checksum"), "9e107d9d372bb6826bd81d3542a419d6")
+	verified, err := check_source_checksum(ctx, source, pdf)
+	if err != nil {
+		t.Fatalf("check_source_checksum() error = %v", err)
+	}
+	if expected, _ := verified.Value(CtxKey("publisher_checksum")).(string); len(expected) > 0 {
+		t.Errorf("check_source_checksum() left the checksum of the source %v for the pdf", expected)
+	}
+	if verification, _ := verified.Value(CtxKey("source_checksum")).(*PublisherChecksum); verification == nil || !verification.Verified {
+		t.Errorf("check_source_checksum() source_checksum = %+v, want verified", verification)
+	}
+
+	ctx = context.WithValue(context.Background(), CtxKey("publisher_checksum"), "e4d909c290d0fb1ca068ffaddf22cbd0")
+	if _, err := check_source_checksum(ctx, source, pdf); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("check_source_checksum(mismatch) error = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("check_source_checksum(mismatch) did not reject %v", source)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// analyze_collection_page_clusters groups the pages of the collection whose pHash and dHash are both within
+// --phash-distance of each other, saves the cluster into each page.######.json manifest and into
+// page_clusters.json of the --database-directory, then optionally hard links the images with --dedupe-pages; pages
+// within --dedupe-distance of the first page of their cluster share its images even when their bytes differ
+func analyze_collection_page_clusters(ctx context.Context, pages map[string][]PendingPage) {
+	distance := *flag_i_phash_distance
+	if distance < 0 {
+		return
+	}
+
+	type hashed struct {
+		pp    PendingPage
+		phash uint64
+		dhash uint64
+	}
+	var candidates []hashed
+	for _, record_pages := range pages {
+		for _, pp := range record_pages {
+			phash, phash_err := parseFingerprint(pp.PHash)
+			dhash, dhash_err := parseFingerprint(pp.DHash)
+			if phash_err != nil || dhash_err != nil {
+				continue
+			}
+			candidates = append(candidates, hashed{pp, phash, dhash})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].pp.RecordIdentifier == candidates[j].pp.RecordIdentifier {
+			return candidates[i].pp.PageNumber < candidates[j].pp.PageNumber
+		}
+		return candidates[i].pp.RecordIdentifier < candidates[j].pp.RecordIdentifier
+	})
+
+	hashes := make([][2]uint64, len(candidates))
+	for i, c := range candidates {
+		hashes[i] = [2]uint64{c.phash, c.dhash}
+	}
+	members := clusterImageHashes(ctx, hashes, distance)
+	if ctx.Err() != nil {
+		return
+	}
+
+	clusters := make(map[string][]string) // cluster => manifest paths
+	for root, indexes := range members {
+		if len(indexes) < 2 {
+			continue
+		}
+		representative := candidates[root].pp
+		cluster := representative.PHash + representative.DHash
+		for _, i := range indexes {
+			pp := candidates[i].pp
+			pp.Cluster = cluster
+			if *flag_b_dedupe_pages && i != root {
+				dedupe_distance := *flag_i_dedupe_distance
+				lookalike := dedupe_distance >= 0 &&
+					hammingDistance(candidates[i].phash, candidates[root].phash) <= dedupe_distance &&
+					hammingDistance(candidates[i].dhash, candidates[root].dhash) <= dedupe_distance
+				if shared := share_page_images(representative, pp, lookalike); shared > 0 {
+					pp.SharedImagesWith = representative.Identifier
+					log_info.Printf("page %v now shares %d images with page %v", pp.Identifier, shared, representative.Identifier)
+				}
+			}
+			for j, record_page := range pages[pp.RecordIdentifier] {
+				if record_page.Identifier == pp.Identifier {
+					pages[pp.RecordIdentifier][j] = pp
+				}
+			}
+			pp_save(pp)
+			clusters[cluster] = append(clusters[cluster], pp.ManifestPath)
+		}
+		log_info.Printf("page cluster %v has %d identical-looking pages", cluster, len(indexes))
+	}
+
+	if len(clusters) > 0 {
+		err := write_page_clusters(clusters)
+		if err != nil {
+			log_error.Tracef("failed to write page_clusters.json due to error %v", err)
+		}
+	}
+}
+
+// clusterImageHashes groups the indexes of hashes whose pHash ([0]) and dHash ([1]) are both within distance of each
+// other and returns them by the lowest index of each group, which is the representative of the group
+func clusterImageHashes(ctx context.Context, hashes [][2]uint64, distance int) map[int][]int {
+	// union-find over the hashes that share a pHash band
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	bands := distance + 1
+	if bands > 64 {
+		bands = 64
+	}
+	band_width := int(math.Ceil(64 / float64(bands)))
+	index := make(map[[2]uint64][]int)
+	for i, h := range hashes {
+		if ctx.Err() != nil {
+			return nil
+		}
+		for band := 0; band < bands; band++ {
+			key := [2]uint64{uint64(band), (h[0] >> uint(band*band_width)) & (1<<uint(band_width) - 1)}
+			for _, j := range index[key] {
+				if hammingDistance(h[0], hashes[j][0]) <= distance && hammingDistance(h[1], hashes[j][1]) <= distance {
+					a, b := find(i), find(j)
+					if a < b {
+						parent[b] = a
+					} else if b < a {
+						parent[a] = b
+					}
+				}
+			}
+			index[key] = append(index[key], i)
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range hashes {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+	return members
+}
+
+// write_page_clusters merges clusters into page_clusters.json of the --database-directory
+func write_page_clusters(clusters map[string][]string) error {
+	path := filepath.Join(*flag_s_database_directory, "page_clusters.json")
+	existing := make(map[string][]string)
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &existing); err != nil {
+			log_error.Printf("ignoring the existing %v because it cannot be parsed: %v", path, err)
+		}
+	}
+	for cluster, manifests := range clusters {
+		known := make(map[string]bool)
+		for _, manifest := range existing[cluster] {
+			known[manifest] = true
+		}
+		for _, manifest := range manifests {
+			if !known[manifest] {
+				existing[cluster] = append(existing[cluster], manifest)
+			}
+		}
+	}
+
+	sem_wjsonfile.Acquire()
+	defer sem_wjsonfile.Release()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(existing)
+}
+
+// share_page_images replaces the JPEG, WebP and AVIF images of pp that are byte for byte equal to the images of representative,
+// or every one of them when lookalike, with hard links to them and returns the number of images that are now shared; files on
+// different devices fall back to a symbolic link
+func share_page_images(representative, pp PendingPage, lookalike bool) int {
+	shared := 0
+	pairs := make(map[string]string)
+	for _, theme := range []string{c_theme_light, c_theme_dark} {
+		targets := pageVariants(pp, theme)
+		for format, images := range pageVariants(representative, theme) {
+			for name, source := range images {
+				pairs[source] = targets[format][name]
+			}
+		}
+	}
+	for source, target := range pairs {
+		if len(source) == 0 || len(target) == 0 || source == target {
+			continue
+		}
+		source_info, source_err := os.Stat(source)
+		target_info, target_err := os.Stat(target)
+		if source_err != nil || target_err != nil {
+			continue
+		}
+		if os.SameFile(source_info, target_info) {
+			shared++
+			continue
+		}
+		if !lookalike && !sameFileContents(source, target) {
+			continue // near-identical pages (a different stamp, redaction or signature) keep their own images
+		}
+		temporary := target + ".link"
+		link_err := os.Link(source, temporary)
+		if link_err != nil {
+			absolute, abs_err := filepath.Abs(source)
+			if abs_err != nil {
+				continue
+			}
+			link_err = os.Symlink(absolute, temporary)
+		}
+		if link_err != nil {
+			log_error.Tracef("failed to link %v to %v due to error %v", target, source, link_err)
+			continue
+		}
+		rename_err := os.Rename(temporary, target)
+		if rename_err != nil {
+			log_error.Tracef("failed to replace %v with a link due to error %v", target, rename_err)
+			_ = os.Remove(temporary)
+			continue
+		}
+		shared++
+	}
+	return shared
+}
+
+// sameFileContents returns true when the files at a and b have the same SHA-256 checksum and size
+func sameFileContents(a, b string) bool {
+	a_checksum, a_size, a_err := FileSha256(a)
+	b_checksum, b_size, b_err := FileSha256(b)
+	return a_err == nil && b_err == nil && a_size == b_size && a_checksum == b_checksum
+}
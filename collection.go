@@ -0,0 +1,136 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// analyze_collection runs once every document in the collection has been compiled; these are the analysis passes
+// that require statistics about the whole collection rather than a single page or document
+func analyze_collection(ctx context.Context) {
+	log_info.Printf("started analyze_collection for %d documents", a_i_received_documents.Load())
+	pages := collection_pages()
+	analyze_collection_duplicates(ctx, pages)
+	analyze_collection_page_clusters(ctx, pages)
+	analyze_collection_keywords(ctx, pages)
+	log_info.Printf("completed analyze_collection for %d documents", a_i_received_documents.Load())
+}
+
+// collection_pages groups every PendingPage stored in sm_pages by its RecordIdentifier
+func collection_pages() map[string][]PendingPage {
+	pages := make(map[string][]PendingPage)
+	sm_pages.Range(func(key, value any) bool {
+		pp, ok := value.(PendingPage)
+		if !ok {
+			log_error.Printf("failed to typecast sm_pages[%v] into PendingPage", key)
+			return true
+		}
+		pages[pp.RecordIdentifier] = append(pages[pp.RecordIdentifier], pp)
+		return true
+	})
+	return pages
+}
+
+// collection_corpus returns the terms of the OCR text of every page by page identifier and of every document by
+// record identifier; the text layer holds the same words as the OCR of its pages, so the extracted text is only used
+// for the documents without any OCR text
+func collection_corpus(ctx context.Context, pages map[string][]PendingPage) (map[string][]string, map[string][]string) {
+	page_corpus := make(map[string][]string)
+	document_corpus := make(map[string][]string)
+	for record_identifier, record_pages := range pages {
+		for _, pp := range record_pages {
+			if ctx.Err() != nil {
+				return page_corpus, document_corpus
+			}
+			ocr_text, ocr_err := os.ReadFile(pp.OCRTextPath)
+			if ocr_err != nil {
+				log_debug.Printf("skipping keywords for page %v because %v cannot be read: %v", pp.Identifier, pp.OCRTextPath, ocr_err)
+				continue
+			}
+			terms := extractTerms(string(ocr_text))
+			page_corpus[pp.Identifier] = terms
+			document_corpus[record_identifier] = append(document_corpus[record_identifier], terms...)
+		}
+	}
+
+	sm_resultdatas.Range(func(key, value any) bool {
+		rd, ok := value.(ResultData)
+		if !ok || len(document_corpus[rd.Identifier]) > 0 {
+			return true
+		}
+		if extracted_text, err := os.ReadFile(rd.ExtractedTextPath); err == nil {
+			document_corpus[rd.Identifier] = extractTerms(string(extracted_text))
+		}
+		return true
+	})
+	return page_corpus, document_corpus
+}
+
+// analyze_collection_keywords computes TF-IDF keywords and key phrases for every page against all pages of the
+// collection and for every document against all documents of the collection, then saves the top --keywords
+// into the page.######.json manifests and record.json files
+func analyze_collection_keywords(ctx context.Context, pages map[string][]PendingPage) {
+	if *flag_i_keywords <= 0 {
+		return
+	}
+
+	page_corpus, document_corpus := collection_corpus(ctx, pages)
+	if ctx.Err() != nil {
+		return
+	}
+
+	page_keywords := rankKeywords(page_corpus, *flag_i_keywords)
+	for _, record_pages := range pages {
+		for i, pp := range record_pages {
+			keywords, found := page_keywords[pp.Identifier]
+			if !found {
+				continue
+			}
+			pp.Keywords = keywords
+			record_pages[i] = pp
+			pp_save(pp)
+		}
+	}
+
+	document_keywords := rankKeywords(document_corpus, *flag_i_keywords)
+	for record_identifier, keywords := range document_keywords {
+		data_rd, found := sm_resultdatas.Load(record_identifier)
+		if !found {
+			continue
+		}
+		rd, ok := data_rd.(ResultData)
+		if !ok {
+			log_error.Printf("failed to typecast sm_resultdatas[%v] into ResultData", record_identifier)
+			continue
+		}
+		rd.Keywords = keywords
+		if rd.Metadata == nil {
+			rd.Metadata = make(map[string]string)
+		}
+		rd.Metadata["keywords"] = keywordsToString(keywords)
+		err := WriteResultDataToJson(rd)
+		if err != nil {
+			log_error.Tracef("failed to write the keywords of %v into %v due to error %v", rd.Identifier, rd.RecordPath, err)
+			continue
+		}
+		sm_resultdatas.Store(rd.Identifier, rd)
+		log_info.Printf("document %v keywords: %v", rd.Identifier, rd.Metadata["keywords"])
+	}
+}
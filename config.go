@@ -28,8 +28,21 @@ var (
 	flag_s_pdf_title        = config.NewString("pdf-title", "", "title of the document")
 	flag_s_metadata_columns = config.NewString("csv-metadata-columns", "", "comma separated value of header values that represent metadata ; saved as key => value where key is the column header")
 	flag_s_download_pdf_url = config.NewString("download-pdf-url", "", "url of pdf to download. must start with http or https and must be an application/pdf type less than 369MB in size")
-	flag_s_import_pdf_path  = config.NewString("import-pdf-path", "", "relative path to the pdf that will be processed that are less than 369MB")
-	flag_s_import_directory = config.NewString("import-directory", "", "absolute path to a directory that will import all .pdf files that are less than 369MB")
+	flag_s_import_pdf_path  = config.NewString("import-pdf-path", "", "relative path to the pdf, office document (docx, doc, odt, rtf, txt, eml) or scanned image (tif, tiff, jpg, jpeg, png, jp2) that will be processed that are less than 369MB")
+	flag_s_import_directory = config.NewString("import-directory", "", "absolute path to a directory that will import all .pdf files, office documents and scanned images that are less than 369MB; the images of each directory are imported as the pages of one document")
+	flag_s_import_archive   = config.NewString("import-archive", "", "path to a .zip, .7z, .tar, .tar.gz (.tgz) or .tar.xz (.txz) archive whose pdf files, office documents and scanned images are imported; the path of each entry is saved as metadata")
+	flag_s_pdf_password     = config.NewString("pdf-password", "", "password that decrypts encrypted PDFs whose import row does not provide one")
+	flag_s_trust_store      = config.NewString("signature-trust-store", "", "directory of .pem, .p7c, .crt and .cer root certificates that the digital signatures of PDFs are validated against")
+	flag_s_checksum_policy  = config.NewString("checksum-policy", c_checksum_policy_reject, "What to do with a file that does not match the md5, sha256 or sha512 checksum column of its import row, or whose checksum cannot be verified: reject (delete it and skip the row) or quarantine (move it into the quarantine directory of its record and save its record.json with the status checksum_mismatch or checksum_unverifiable)")
+
+	// Web crawl
+	flag_s_crawl_url       = config.NewString("crawl-url", "", "url of an index page or sitemap.xml to crawl for links to PDF files; each one is downloaded like --download-pdf-url with the text of the link as its title")
+	flag_i_crawl_depth     = config.NewInt("crawl-depth", 1, "Number of links deep that --crawl-url follows pages from the start url. Use 0 to only read the start url.")
+	flag_i_crawl_max_pages = config.NewInt("crawl-max-pages", 999, "Maximum number of pages and sitemaps that --crawl-url fetches.")
+	flag_s_crawl_include   = config.NewString("crawl-include", "", "regular expression that the PDF links found by --crawl-url must match to be imported")
+	flag_s_crawl_exclude   = config.NewString("crawl-exclude", "", "regular expression of the pages and PDF links that --crawl-url skips")
+	flag_b_crawl_same_host = config.NewBool("crawl-same-host", true, "only follow pages and import PDF links on the host of --crawl-url")
+	flag_b_crawl_sitemap   = config.NewBool("crawl-sitemap", true, "also read the /sitemap.xml of the host of --crawl-url")
 
 	// Import .xlsx collections
 	flag_s_import_xlsx               = config.NewString("import-xlsx", "", "relative path to an excel spreadsheet where sheet 1 is a table of urls and metadata properties. use additional args to associate columns to key data points.")
@@ -38,6 +51,8 @@ var (
 	flag_s_xlsx_column_path          = config.NewString("xlsx-column-path", "", "value of row 1 whose column correlates to absolute paths of PDF files")
 	flag_s_xlsx_column_record_number = config.NewString("xlsx-column-record-number", "", "value of row 1 whose column correlates to a unique record identifier or number")
 	flag_s_xlsx_column_title         = config.NewString("xlsx-column-title", "", "value of row 1 whose column correlates to the title of the document")
+	flag_s_xlsx_column_password      = config.NewString("xlsx-column-password", "", "value of row 1 whose column correlates to the password of encrypted PDF files")
+	flag_s_xlsx_column_checksum      = config.NewString("xlsx-column-checksum", "", "value of row 1 whose column correlates to the md5, sha256 or sha512 checksum that the publisher provides for each file; a column named checksum is always used")
 
 	// Import .csv collections
 	flag_s_import_csv               = config.NewString("import-csv", "", "relative path to an excel spreadsheet where output is a comma separated table of urls and metadata properties. use additional args to associate columns to key data points.")
@@ -45,19 +60,72 @@ var (
 	flag_s_csv_column_path          = config.NewString("csv-column-path", "", "value of row 1 whose column correlates to absolute paths of PDF files")
 	flag_s_csv_column_record_number = config.NewString("csv-column-record-number", "", "value of row 1 whose column correlates to a unique record identifier or number")
 	flag_s_csv_column_title         = config.NewString("csv-column-title", "", "value of row 1 whose column correlates to the title of the document")
+	flag_s_csv_column_password      = config.NewString("csv-column-password", "", "value of row 1 whose column correlates to the password of encrypted PDF files")
+	flag_s_csv_column_checksum      = config.NewString("csv-column-checksum", "checksum", "value of row 1 whose column correlates to the md5, sha256 or sha512 checksum that the publisher provides for each file")
 	flag_s_pdf_metadata_json        = config.NewString("metadata-json", "", "json key value map[string]string")
 
 	// Runtime appliance control levers
 	flag_g_jpg_quality      = config.NewInt("jpeg-quality", 96, "Quality percentage (as int 1-100) for compressing PNG images into JPEG files.")
 	flag_g_progressive_jpeg = config.NewBool("progressive", true, "Convert compressed JPEG images into progressive images.")
+	flag_s_original_formats = config.NewString("original-formats", c_format_jpg, "Comma separated formats (jpg, png, webp, avif) of the original page image; the formats of the other renditions are set in the config file.")
+	flag_i_render_dpi       = config.NewInt("render-dpi", 369, "Resolution (DPI) that pdftoppm renders the original page image at; the renditions in the config file are resized from it.")
+
+	// Deep Zoom
+	flag_b_deep_zoom           = config.NewBool("deep-zoom", false, "cut the original light and dark page images into a DZI tile pyramid for high-resolution zooming in the reader")
+	flag_i_deep_zoom_tile_size = config.NewInt("deep-zoom-tile-size", 254, "Width and height in pixels of each deep zoom tile, excluding the overlap.")
+	flag_i_deep_zoom_overlap   = config.NewInt("deep-zoom-overlap", 1, "Pixels that each deep zoom tile overlaps its neighbours by.")
+
+	// IIIF
+	flag_s_iiif_base_url  = config.NewString("iiif-base-url", "", "public URL that serves the --database-directory; when set, static IIIF Image API level-0 tiles are written for every page and a IIIF Presentation 3 manifest.json for every document")
+	flag_i_iiif_tile_size = config.NewInt("iiif-tile-size", 512, "Width and height in pixels of each IIIF tile.")
+
+	// Dark Mode
+	flag_s_dark_foreground = config.NewString("dark-foreground", "250,226,203", "R,G,B colour that black ink is mapped to in dark mode images.")
+	flag_s_dark_background = config.NewString("dark-background", "40,40,86", "R,G,B colour that white paper is mapped to in dark mode images.")
+	flag_s_dark_palette    = config.NewString("dark-palette", "", "Semicolon separated R,G,B colour stops that dark mode images are mapped along from black ink to white paper, such as 250,226,203;140,140,170;40,40,86. Overrides --dark-foreground and --dark-background.")
+	flag_f_dark_saturation = config.NewFloat64("dark-saturation", 0.35, "Pixels at or above this saturation (0.0-1.0) keep their colour in dark mode images. Use 0 to convert every pixel.")
+
+	// Page Orientation
+	flag_b_orientation            = config.NewBool("orientation", false, "rotate rendered pages upright using tesseract orientation and script detection; runs tesseract once more per page and requires the osd traineddata")
+	flag_f_orientation_confidence = config.NewFloat64("orientation-confidence", 14.0, "Minimum tesseract orientation confidence required before a page is rotated.")
+	flag_b_deskew                 = config.NewBool("deskew", false, "level the text lines of rendered pages using a projection profile; decodes every page image once more and re-encodes the skewed ones")
+	flag_f_max_skew               = config.NewFloat64("max-skew", 5.0, "Maximum skew in degrees that --deskew corrects.")
+
+	// Blank Pages
+	flag_f_blank_threshold = config.NewFloat64("blank-threshold", 0.001, "Pages whose ink coverage (0.0-1.0) is below this threshold are flagged as blank.")
+	flag_s_blank_policy    = config.NewString("blank-policy", c_blank_policy_skip_ocr, "What to do with blank pages: flag (record only), skip-ocr (no tesseract) or skip-all (no thumbnails and no tesseract)")
+
+	// Collection Analysis (runs after every document has been compiled)
+	flag_i_keywords             = config.NewInt("keywords", 17, "Number of TF-IDF keywords and key phrases to save per page and per document. Use 0 to disable.")
+	flag_f_duplicate_similarity = config.NewFloat64("duplicate-similarity", 0.9, "Minimum MinHash similarity (0.0-1.0) of the OCR text for two documents to be linked as near-duplicates.")
+	flag_i_simhash_distance     = config.NewInt("simhash-distance", 3, "Maximum number of differing SimHash bits (0-64) for two pages to be linked as near-duplicates.")
+	flag_i_phash_distance       = config.NewInt("phash-distance", 4, "Maximum number of differing pHash and dHash bits (0-64) for two page images to be clustered as identical-looking. Use -1 to disable.")
+
+	// Duplicates
+	flag_b_skip_duplicates = config.NewBool("skip-duplicates", false, "do not render a PDF whose SHA-512 checksum already exists in the database directory; link it to the existing record instead")
+	flag_b_dedupe_pages    = config.NewBool("dedupe-pages", false, "replace the JPEG, WebP and AVIF images of clustered identical-looking pages with hard links to the images of the first page in the cluster when they are byte for byte equal or within --dedupe-distance")
+	flag_i_dedupe_distance = config.NewInt("dedupe-distance", -1, "Maximum number of differing pHash and dHash bits (0-64) for --dedupe-pages to link the images of a clustered page to the first page in the cluster even when their bytes differ. Use -1 to only link byte for byte equal images.")
+
+	// Downloads
+	flag_i_max_download_mb = config.NewInt("max-download-mb", 369, "Downloads larger than this many megabytes are rejected.")
+	flag_b_refetch         = config.NewBool("refetch", false, "download files that were already downloaded again when the server reports that they changed (ETag or Last-Modified)")
+	flag_s_user_agent      = config.NewString("user-agent", "apario-writer/1.0 (+https://github.com/andreimerlescu/apario-writer)", "User-Agent sent with every request; include a way for the site to contact you.")
+	flag_f_host_rps        = config.NewFloat64("host-rps", 1.0, "Requests per second sent to each host. Use 0 to not limit them.")
+	flag_i_host_burst      = config.NewInt("host-burst", 1, "Requests that can be sent to a host at once before --host-rps paces them.")
+	flag_i_max_retry_after = config.NewInt("max-retry-after", 600, "Longest Retry-After in seconds of a 429 or 503 response that is waited for before the download fails.")
+	flag_b_robots          = config.NewBool("robots", false, "skip the URLs that the robots.txt of their host disallows for the --user-agent and honour its Crawl-delay")
 
 	// Network Intensive Tasks (higher values could result in throttling or IP banning - recommended value: 1)
 	flag_b_sem_download = config.NewInt("download", 1, "Semaphore Limiter for downloading PDF files from URLs.")
 
 	// IO Intensive Tasks - High Intensity
-	flag_b_sem_tesseract = config.NewInt("tesseract", 1, "Semaphore Limiter for `tesseract` binary.")                     // tesseract uses all threads available
-	flag_b_sem_pdftotext = config.NewInt("pdftotext", runtime.GOMAXPROCS(0), "Semaphore Limiter for `pdftotext` binary.") // single threaded
-	flag_b_sem_pdftoppm  = config.NewInt("pdftoppm", runtime.GOMAXPROCS(0), "Semaphore Limiter for `pdftoppm` binary.")   // single threaded
+	flag_b_sem_tesseract      = config.NewInt("tesseract", 1, "Semaphore Limiter for `tesseract` binary.")                     // tesseract uses all threads available
+	flag_b_sem_pdftotext      = config.NewInt("pdftotext", runtime.GOMAXPROCS(0), "Semaphore Limiter for `pdftotext` binary.") // single threaded
+	flag_b_sem_pdftoppm       = config.NewInt("pdftoppm", runtime.GOMAXPROCS(0), "Semaphore Limiter for `pdftoppm` binary.")   // single threaded
+	flag_b_sem_cwebp          = config.NewInt("cwebp", 3, "Semaphore Limiter for `cwebp` binary.")                             // multi threaded with -mt
+	flag_b_sem_avifenc        = config.NewInt("avifenc", 1, "Semaphore Limiter for `avifenc` binary.")                         // uses all threads available
+	flag_b_sem_opj_decompress = config.NewInt("opj_decompress", 3, "Semaphore Limiter for `opj_decompress` binary.")
+	flag_b_sem_soffice        = config.NewInt("soffice", 2, "Semaphore Limiter for `soffice` binary.")
 	// IO Intensive Tasks - Medium Intensity
 	flag_g_sem_png2jpg   = config.NewInt("png2jpg", 33, "Semaphore Limiter for converting PNG images to JPG.")
 	flag_g_sem_wjsonfile = config.NewInt("wjsonfile", 33, "Semaphore Limiter for writing a JSON file to disk.")
@@ -66,12 +134,12 @@ var (
 	flag_g_sem_shafile  = config.NewInt("shafile", 333, "Semaphore Limiter for calculating the SHA256 checksum of files.")
 
 	// Compute Intensive Tasks - High Intensity
-	flag_b_sem_pdfcpu  = config.NewInt("pdfcpu", 3, "Semaphore Limiter for `pdfcpu` binary.")
-	flag_b_sem_gs      = config.NewInt("gs", 3, "Semaphore Limiter for `gs` binary.")
-	flag_b_sem_convert = config.NewInt("convert", 3, "Semaphore Limiter for `convert` binary.")
+	flag_b_sem_pdfcpu = config.NewInt("pdfcpu", 3, "Semaphore Limiter for the in-process pdfcpu library (validate, info, optimize and extract).")
+	flag_b_sem_gs     = config.NewInt("gs", 3, "Semaphore Limiter for `gs` binary.")
 	// Compute Intensive Tasks - Medium Intensity
 	flag_g_sem_resize    = config.NewInt("resize", 66, "Semaphore Limiter for resize PNG or JPG images.")
 	flag_g_sem_darkimage = config.NewInt("darkimage", 66, "Semaphore Limiter for converting an image to dark mode.")
+	flag_g_sem_deepzoom  = config.NewInt("deepzoom", 6, "Semaphore Limiter for cutting page images into deep zoom tiles.")
 	// Compute Intensive Tasks - Low Intensity
 	flag_g_sem_watermark = config.NewInt("watermark", 999, "Semaphore Limiter for adding a watermark to an image.")
 	flag_g_sem_shastring = config.NewInt("shastring", 999, "Semaphore Limiter for calculating the SHA256 checksum of a string.")
@@ -0,0 +1,361 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	countable_waitgroup "github.com/andreimerlescu/go-countable-waitgroup"
+	"golang.org/x/net/html"
+)
+
+// CrawledLink is a link to a PDF that was found while crawling
+type CrawledLink struct {
+	URL       string
+	Title     string // text of the link, or the title of the page it was found on
+	PageURL   string
+	PageTitle string
+}
+
+// CrawlOptions limit which pages are followed and which PDF links are collected by crawl
+type CrawlOptions struct {
+	Depth    int            // links are followed this many pages deep from the start URL
+	MaxPages int            // pages and sitemaps that are fetched at most
+	SameHost bool           // only follow and collect links on the host of the start URL
+	Sitemap  bool           // also read /sitemap.xml of the host of the start URL
+	Include  *regexp.Regexp // when set only the PDF links that match are collected
+	Exclude  *regexp.Regexp // neither pages nor PDF links that match are used
+}
+
+type crawlPage struct {
+	url   string
+	depth int
+}
+
+// sitemap is the urlset of a sitemap.xml or the sitemapindex that lists other sitemaps
+type sitemap struct {
+	URLs     []sitemapURL `xml:"url"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+const c_crawl_page_bytes = 16 << 20 // larger pages are truncated
+
+var re_whitespace = regexp.MustCompile(`\s+`)
+
+// isPDFLink returns true when the path of link ends with .pdf
+func isPDFLink(link *url.URL) bool {
+	return strings.EqualFold(path.Ext(link.Path), ".pdf")
+}
+
+// crawl fetches the HTML pages and sitemaps reachable from start within options and returns the PDF links it found in
+// the order it found them along with the errors of the pages that could not be read
+func crawl(ctx context.Context, client *http.Client, start string, options CrawlOptions) ([]CrawledLink, []error) {
+	start_url, err := url.Parse(start)
+	if err != nil || (start_url.Scheme != "http" && start_url.Scheme != "https") {
+		return nil, []error{fmt.Errorf("invalid --crawl-url %v", start)}
+	}
+	var (
+		links   []CrawledLink
+		errs    []error
+		seen    = map[string]bool{}
+		queue   = []crawlPage{{url: start_url.String()}}
+		fetched = 0
+	)
+	allowed := func(link *url.URL) bool {
+		if link.Scheme != "http" && link.Scheme != "https" {
+			return false
+		}
+		if options.SameHost && !strings.EqualFold(link.Hostname(), start_url.Hostname()) {
+			return false
+		}
+		return options.Exclude == nil || !options.Exclude.MatchString(link.String())
+	}
+	collect := func(link *url.URL, title, page_url, page_title string) {
+		link.Fragment = ""
+		if seen[link.String()] || !allowed(link) || (options.Include != nil && !options.Include.MatchString(link.String())) {
+			return
+		}
+		seen[link.String()] = true
+		if len(title) == 0 {
+			title = strings.TrimSuffix(path.Base(link.Path), path.Ext(link.Path))
+		}
+		links = append(links, CrawledLink{URL: link.String(), Title: title, PageURL: page_url, PageTitle: page_title})
+	}
+	follow := func(link *url.URL, depth int) {
+		link.Fragment = ""
+		if depth > options.Depth || seen[link.String()] || !allowed(link) {
+			return
+		}
+		seen[link.String()] = true
+		queue = append(queue, crawlPage{url: link.String(), depth: depth})
+	}
+	seen[start_url.String()] = true
+	if options.Sitemap {
+		follow(&url.URL{Scheme: start_url.Scheme, Host: start_url.Host, Path: "/sitemap.xml"}, 0)
+	}
+
+	for len(queue) > 0 && (options.MaxPages <= 0 || fetched < options.MaxPages) {
+		if ctx.Err() != nil {
+			return links, append(errs, ctx.Err())
+		}
+		page := queue[0]
+		queue = queue[1:]
+		fetched++
+		base, body, media_type, err := crawl_fetch(ctx, client, page.url)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if strings.HasSuffix(media_type, "xml") && media_type != "application/xhtml+xml" {
+			var entries sitemap
+			if err := xml.Unmarshal(body, &entries); err != nil {
+				errs = append(errs, fmt.Errorf("failed to parse the sitemap %v due to error %v", page.url, err))
+				continue
+			}
+			for _, entry := range entries.Sitemaps {
+				if link, err := base.Parse(strings.TrimSpace(entry.Loc)); err == nil {
+					follow(link, page.depth) // a sitemap index is not a level of the site
+				}
+			}
+			for _, entry := range entries.URLs {
+				link, err := base.Parse(strings.TrimSpace(entry.Loc))
+				if err != nil {
+					continue
+				}
+				if isPDFLink(link) {
+					collect(link, "", page.url, "")
+				} else {
+					follow(link, page.depth+1)
+				}
+			}
+			continue
+		}
+
+		title, anchors := html_links(body)
+		for _, anchor := range anchors {
+			if base_href := anchor.base; len(base_href) > 0 {
+				if parsed, err := base.Parse(base_href); err == nil {
+					base = parsed
+				}
+				continue
+			}
+			link, err := base.Parse(strings.TrimSpace(anchor.href))
+			if err != nil {
+				continue
+			}
+			if isPDFLink(link) {
+				text := anchor.text
+				if len(text) == 0 {
+					text = title
+				}
+				collect(link, text, page.url, title)
+			} else {
+				follow(link, page.depth+1)
+			}
+		}
+	}
+	return links, errs
+}
+
+// crawl_fetch downloads the page at link and returns its final URL, body and media type
+func crawl_fetch(ctx context.Context, client *http.Client, link string) (*url.URL, []byte, string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	sem_download.Acquire()
+	defer sem_download.Release()
+	if err := polite_request(ctx, client, request); err != nil {
+		return nil, nil, "", err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, nil, "", fmt.Errorf("GET %v returned %v", link, response.Status)
+	}
+	media_type, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if media_type != "text/html" && media_type != "application/xhtml+xml" && !strings.HasSuffix(media_type, "xml") {
+		return nil, nil, "", fmt.Errorf("GET %v returned %v instead of html or a sitemap", link, media_type)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, c_crawl_page_bytes))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return response.Request.URL, body, media_type, nil
+}
+
+type htmlAnchor struct {
+	href string
+	text string
+	base string // href of a <base> element, which changes how the anchors after it resolve
+}
+
+// html_links returns the title of the HTML page in body and its anchors in document order
+func html_links(body []byte) (string, []htmlAnchor) {
+	document, err := html.Parse(strings.NewReader(string(body)))
+	if err != nil {
+		return "", nil
+	}
+	var title string
+	var anchors []htmlAnchor
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.Data {
+			case "title":
+				if len(title) == 0 {
+					title = html_text(node)
+				}
+			case "base":
+				if href := html_attribute(node, "href"); len(href) > 0 {
+					anchors = append(anchors, htmlAnchor{base: href})
+				}
+			case "a", "area":
+				if href := html_attribute(node, "href"); len(href) > 0 {
+					text := html_text(node)
+					if len(text) == 0 {
+						text = strings.TrimSpace(html_attribute(node, "title"))
+					}
+					anchors = append(anchors, htmlAnchor{href: href, text: text})
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(document)
+	return title, anchors
+}
+
+func html_attribute(node *html.Node, name string) string {
+	for _, attribute := range node.Attr {
+		if attribute.Key == name {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+// html_text returns the text inside node with its whitespace collapsed
+func html_text(node *html.Node) string {
+	var text strings.Builder
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			text.WriteString(node.Data)
+			text.WriteByte(' ')
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return strings.TrimSpace(re_whitespace.ReplaceAllString(text.String(), " "))
+}
+
+// crawl_options builds the CrawlOptions from the --crawl-* flags
+func crawl_options() (CrawlOptions, error) {
+	options := CrawlOptions{
+		Depth:    *flag_i_crawl_depth,
+		MaxPages: *flag_i_crawl_max_pages,
+		SameHost: *flag_b_crawl_same_host,
+		Sitemap:  *flag_b_crawl_sitemap,
+	}
+	var err error
+	if len(*flag_s_crawl_include) > 0 {
+		if options.Include, err = regexp.Compile(*flag_s_crawl_include); err != nil {
+			return options, fmt.Errorf("invalid --crawl-include: %v", err)
+		}
+	}
+	if len(*flag_s_crawl_exclude) > 0 {
+		if options.Exclude, err = regexp.Compile(*flag_s_crawl_exclude); err != nil {
+			return options, fmt.Errorf("invalid --crawl-exclude: %v", err)
+		}
+	}
+	return options, nil
+}
+
+// process_crawl crawls start for PDF links and downloads each of them with process_download_pdf, using the text of
+// the link as the title of the document
+func process_crawl(ctx context.Context, start string, metadata_json string) error {
+	options, err := crawl_options()
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	metadata := make(map[string]string)
+	if len(metadata_json) > 0 {
+		if err := json.Unmarshal([]byte(metadata_json), &metadata); err != nil {
+			log_debug.Tracef("failed to parse the --metadata-json due to err %v", err)
+		}
+	}
+
+	links, errs := crawl(ctx, http_client, start, options)
+	for _, crawl_err := range errs {
+		log_error.Tracef("crawling %v: %v", start, crawl_err)
+	}
+	log_info.Printf("crawling %v found %d pdf links", start, len(links))
+
+	// every link is counted before the downloads start so the pipeline cannot finish while they wait on --host-rps
+	a_i_total_documents.Add(int32(len(links)))
+	wg := countable_waitgroup.CountableWaitGroup{}
+	for _, link := range links {
+		link_metadata := map[string]string{"title": link.Title, "crawled_from": link.PageURL}
+		if len(link.PageTitle) > 0 {
+			link_metadata["page_title"] = link.PageTitle
+		}
+		link_json, json_err := merge_metadata_json(metadata, link_metadata)
+		if json_err != nil {
+			a_i_total_documents.Add(-1)
+			log_error.Tracef("failed to import %v from %v due to err %v", link.URL, link.PageURL, json_err)
+			continue
+		}
+		counted := &countedDocument{}
+		link_ctx := context.WithValue(ctx, CtxKey("counted_document"), counted)
+		wg.Add(1)
+		go func(wg *countable_waitgroup.CountableWaitGroup, link CrawledLink, link_json string) {
+			defer wg.Done()
+			if download_err := process_download_pdf(link_ctx, link.URL, link_json); download_err != nil {
+				log_error.Tracef("failed to import %v from %v due to err %v", link.URL, link.PageURL, download_err)
+			}
+			if !counted.claimed.Load() {
+				a_i_total_documents.Add(-1) // counted above but failed, skipped or recorded without entering ch_ImportedRow
+			}
+		}(&wg, link, link_json)
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,182 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_crawl(t *testing.T) {
+	defer func(rps float64) { *flag_f_host_rps = rps }(*flag_f_host_rps)
+	*flag_f_host_rps = 0
+
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	page := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, body)
+		}
+	}
+	mux.HandleFunc("/readingroom/", page(`<html><head><title>Reading Room</title></head><body>
+		<a href="docs/memo-1.pdf">  STAR GATE
+			memo </a>
+		<a href="/readingroom/docs/memo-1.pdf#page=2">duplicate</a>
+		<a href="docs/notes.PDF"><img alt=""></a>
+		<a href="collection/stargate">next page</a>
+		<a href="https://elsewhere.example/other.pdf">elsewhere</a>
+		<a href="logout">log out</a>
+		<a href="mailto:foia@cia.gov">mail</a>
+	</body></html>`))
+	mux.HandleFunc("/readingroom/collection/stargate", page(`<title>STARGATE</title>
+		<a href="../docs/memo-2.pdf">Memo 2</a>
+		<a href="deeper">deeper</a>`))
+	mux.HandleFunc("/readingroom/collection/deeper", page(`<a href="../docs/too-deep.pdf">too deep</a>`))
+	mux.HandleFunc("/readingroom/logout", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("crawl() followed the excluded %v", r.URL)
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+			<url><loc>%v/readingroom/docs/from-sitemap.pdf</loc></url>
+			<url><loc>%v/readingroom/docs/skipped.pdf</loc></url>
+		</urlset>`, server.URL, server.URL)
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	options := CrawlOptions{
+		Depth:    1,
+		SameHost: true,
+		Sitemap:  true,
+		Exclude:  regexp.MustCompile(`logout|skipped`),
+	}
+	links, errs := crawl(context.Background(), server.Client(), server.URL+"/readingroom/", options)
+	if len(errs) != 0 {
+		t.Errorf("crawl() errors = %v", errs)
+	}
+	root := server.URL + "/readingroom/"
+	want := []CrawledLink{
+		{URL: root + "docs/memo-1.pdf", Title: "STAR GATE memo", PageURL: root, PageTitle: "Reading Room"},
+		{URL: root + "docs/notes.PDF", Title: "Reading Room", PageURL: root, PageTitle: "Reading Room"},
+		{URL: root + "docs/from-sitemap.pdf", Title: "from-sitemap", PageURL: server.URL + "/sitemap.xml"},
+		{URL: root + "docs/memo-2.pdf", Title: "Memo 2", PageURL: root + "collection/stargate", PageTitle: "STARGATE"},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("crawl() = %+v\nwant %+v", links, want)
+	}
+
+	options.Include = regexp.MustCompile(`memo-\d`)
+	options.Sitemap = false
+	options.Depth = 0
+	links, _ = crawl(context.Background(), server.Client(), root, options)
+	if len(links) != 1 || links[0].URL != root+"docs/memo-1.pdf" {
+		t.Errorf("crawl() with --crawl-include and a depth of 0 = %+v, want memo-1.pdf", links)
+	}
+
+	if _, errs := crawl(context.Background(), server.Client(), "ftp://example.com/", options); len(errs) != 1 {
+		t.Errorf("crawl(ftp) errors = %v, want an invalid url", errs)
+	}
+}
+
+func Test_process_crawl(t *testing.T) {
+	loggers := []**CustomLogger{&log_error, &log_info, &log_debug}
+	for _, logger := range loggers {
+		previous := *logger
+		*logger = NewCustomLogger(io.Discard, "", 0, 1)
+		t.Cleanup(func() { *logger = previous })
+	}
+	defer func(dir string, clam bool, rps float64, depth int, client *http.Client) {
+		*flag_s_database_directory, *flag_b_disable_clamav, *flag_f_host_rps, *flag_i_crawl_depth, http_client = dir, clam, rps, depth, client
+	}(*flag_s_database_directory, *flag_b_disable_clamav, *flag_f_host_rps, *flag_i_crawl_depth, http_client)
+	*flag_s_database_directory = t.TempDir()
+	*flag_b_disable_clamav = true
+	*flag_f_host_rps = 0
+	*flag_i_crawl_depth = 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readingroom/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<a href="docs/memo-1.pdf">Memo 1</a> <a href="docs/memo-2.pdf">Memo 2</a> <a href="docs/gone.pdf">Gone</a>`)
+	})
+	for name, pages := range map[string]int{"memo-1.pdf": 1, "memo-2.pdf": 2} {
+		body := testPDF(pages)
+		mux.HandleFunc("/readingroom/docs/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(body)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	http_client = server.Client()
+
+	received := make(chan ResultData, 3)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case row := <-ch_ImportedRow.Chan():
+				if rd, ok := row.(ResultData); ok {
+					received <- rd
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	total := a_i_total_documents.Load()
+	defer a_i_total_documents.Store(total)
+	if err := process_crawl(context.Background(), server.URL+"/readingroom/", `{"collection":"test"}`); err != nil {
+		t.Fatalf("process_crawl() error = %v", err)
+	}
+	if got := a_i_total_documents.Load() - total; got != 2 {
+		t.Errorf("process_crawl() counted %d documents, want 2", got)
+	}
+
+	var urls []string
+	for len(urls) < 2 {
+		select {
+		case rd := <-received:
+			sm_resultdatas.Delete(rd.Identifier)
+			sm_documents.Delete(rd.Identifier)
+			if rd.Metadata["collection"] != "test" || !strings.HasPrefix(rd.Metadata["crawled_from"], "http://") {
+				t.Errorf("process_crawl() metadata = %v", rd.Metadata)
+			}
+			urls = append(urls, rd.URL)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("process_crawl() sent %v into ch_ImportedRow, want 2 documents", urls)
+		}
+	}
+	sort.Strings(urls)
+	want := []string{server.URL + "/readingroom/docs/memo-1.pdf", server.URL + "/readingroom/docs/memo-2.pdf"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("process_crawl() imported %v, want %v", urls, want)
+	}
+}
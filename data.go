@@ -20,6 +20,7 @@ package main
 import (
 	"context"
 	"image/color"
+	"net/http"
 	"os"
 	"regexp"
 	"sync"
@@ -43,28 +44,48 @@ const (
 	cErrorLog = "error"
 )
 
+// Dark Mode luminance curve (0.0 black - 1.0 white)
+const (
+	c_dark_ink_level   = 0.2 // at or below is entirely foreground
+	c_dark_paper_level = 0.9 // at or above is entirely background
+)
+
+// Terminal states of a ResultData that is never sent into ch_ImportedRow
+const (
+	c_status_encrypted_no_password = "encrypted_no_password"
+	c_status_checksum_mismatch     = "checksum_mismatch"
+	c_status_checksum_unverifiable = "checksum_unverifiable"
+)
+
+const c_attachment_depth = 3 // attachments of attachments are imported this many levels deep
+
 const FileFullTimeFormat = "20060102150405GMT"
 
 var (
 	startedAt = time.Now().UTC()
 
 	// Integers
-	channel_buffer_size    int = 1          // Buffered Channel's Size
-	reader_buffer_bytes    int = 128 * 1024 // 128KB default buffer for reading CSV, XLSX, and PSV files into memory
-	jpeg_compression_ratio     = 90         // Progressive JPEG Quality (valid options are 1-100)
+	channel_buffer_size int = 1          // Buffered Channel's Size
+	reader_buffer_bytes int = 128 * 1024 // 128KB default buffer for reading CSV, XLSX, and PSV files into memory
 
-	// Colors
+	// Colors (overridden by --dark-background and --dark-foreground)
 	color_background = color.RGBA{R: 40, G: 40, B: 86, A: 255}    // navy blue
 	color_text       = color.RGBA{R: 250, G: 226, B: 203, A: 255} // sky yellow
 
+	// Dark Mode palette from ink to paper (--dark-foreground and --dark-background, or --dark-palette)
+	sl_dark_palette = []color.RGBA{color_text, color_background}
+
 	// Strings
 	dir_current_directory string
 	arg_config_yaml       string
 
 	// Maps
 	m_cryptonyms        = make(map[string]string)
+	m_stop_words        = make(map[string]bool)
 	m_used_identifiers  = make(map[string]bool)
+	m_pdf_checksums     = make(map[string]string) // PDFChecksum => RecordPath of every record.json in the database directory
 	m_required_binaries = make(map[string]string)
+	m_optional_binaries = make(map[string]string)
 	m_months            = map[string]time.Month{
 		"jan": time.January, "january": time.January, "01": time.January, "1": time.January,
 		"feb": time.February, "february": time.February, "02": time.February, "2": time.February,
@@ -87,30 +108,49 @@ var (
 	re_date5 = regexp.MustCompile(`(?i)(January|Jan|February|Feb|March|Mar|April|Apr|May|June|Jun|July|Jul|August|Aug|September|Sep|October|Oct|November|Nov|December|Dec)\s(\d{1,2})(st|nd|rd|th)?,?\s(\d{2,4})`)
 	re_date4 = regexp.MustCompile(`(?i)(January|Jan|February|Feb|March|Mar|April|Apr|May|June|Jun|July|Jul|August|Aug|September|Sep|October|Oct|November|Nov|December|Dec)\s(\d{4})`)
 	re_date6 = regexp.MustCompile(`(\d{4})`)
+	re_token = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9'\-]*`)
 
 	// Synchronization
-	mu_identifier = sync.RWMutex{}
+	mu_identifier    = sync.RWMutex{}
+	mu_pdf_checksums = sync.RWMutex{}
+	once_pdf_index   = sync.Once{}
 	//wg_active_tasks = cwg.CountableWaitGroup{}
 
 	// Binary Dependencies
 	sl_required_binaries = []string{
-		"pdfcpu",
 		"gs",
 		"pdftotext",
-		"convert",
 		"pdftoppm",
 		"tesseract",
 		"clamscan",
 	}
 	sl_required_binaries_no_clam = []string{
-		"pdfcpu",
 		"gs",
 		"pdftotext",
-		"convert",
 		"pdftoppm",
 		"tesseract",
 	}
 
+	sl_optional_binaries = []string{
+		"cwebp",
+		"avifenc",
+		"opj_decompress",
+		"soffice",
+	}
+
+	// Scanned images that are imported as pages
+	m_scan_extensions = map[string]bool{".tif": true, ".tiff": true, ".jpg": true, ".jpeg": true, ".png": true, ".jp2": true, ".j2k": true}
+
+	// Office and text documents that are converted to PDF with soffice
+	m_office_extensions = map[string]bool{".docx": true, ".doc": true, ".odt": true, ".rtf": true, ".txt": true}
+
+	// Emails and mailboxes that are rendered to PDF
+	m_email_extensions = map[string]bool{".eml": true, ".mbox": true}
+
+	// Renditions
+	sl_rendition_profiles = default_rendition_profiles()
+	sl_original_formats   = []string{c_format_jpg}
+
 	// Atomics
 	a_i_total_pages        = atomic.Int64{}
 	a_i_received_documents = atomic.Int32{}
@@ -121,6 +161,12 @@ var (
 	sm_resultdatas      sync.Map
 	sm_documents        sync.Map
 	sm_pages            sync.Map
+	sm_host_limiters    sync.Map // host => *rate.Limiter
+	sm_host_pauses      sync.Map // host => time.Time until which a Retry-After holds its requests back
+	sm_robots           sync.Map // robots.txt URL => robotsRules
+
+	// HTTP client of every download and crawl, see load_http_client
+	http_client = http.DefaultClient
 
 	log_info  *CustomLogger
 	log_debug *CustomLogger
@@ -128,21 +174,25 @@ var (
 	log_files map[string]*os.File
 
 	// Semaphores
-	sem_tesseract  = sem.New(*flag_b_sem_tesseract)
-	sem_download   = sem.New(*flag_b_sem_download)
-	sem_pdfcpu     = sem.New(*flag_b_sem_pdfcpu)
-	sem_gs         = sem.New(*flag_b_sem_gs)
-	sem_pdftotext  = sem.New(*flag_b_sem_pdftotext)
-	sem_convert    = sem.New(*flag_b_sem_convert)
-	sem_pdftoppm   = sem.New(*flag_b_sem_pdftoppm)
-	sem_png2jpg    = sem.New(*flag_g_sem_png2jpg)
-	sem_resize     = sem.New(*flag_g_sem_resize)
-	sem_shafile    = sem.New(*flag_g_sem_shafile)
-	sema_watermark = sem.New(*flag_g_sem_watermark)
-	sem_darkimage  = sem.New(*flag_g_sem_darkimage)
-	sem_filedata   = sem.New(*flag_g_sem_filedata)
-	sem_shastring  = sem.New(*flag_g_sem_shastring)
-	sem_wjsonfile  = sem.New(*flag_g_sem_wjsonfile)
+	sem_tesseract      = sem.New(*flag_b_sem_tesseract)
+	sem_download       = sem.New(*flag_b_sem_download)
+	sem_pdfcpu         = sem.New(*flag_b_sem_pdfcpu)
+	sem_gs             = sem.New(*flag_b_sem_gs)
+	sem_pdftotext      = sem.New(*flag_b_sem_pdftotext)
+	sem_pdftoppm       = sem.New(*flag_b_sem_pdftoppm)
+	sem_png2jpg        = sem.New(*flag_g_sem_png2jpg)
+	sem_resize         = sem.New(*flag_g_sem_resize)
+	sem_shafile        = sem.New(*flag_g_sem_shafile)
+	sema_watermark     = sem.New(*flag_g_sem_watermark)
+	sem_darkimage      = sem.New(*flag_g_sem_darkimage)
+	sem_filedata       = sem.New(*flag_g_sem_filedata)
+	sem_shastring      = sem.New(*flag_g_sem_shastring)
+	sem_wjsonfile      = sem.New(*flag_g_sem_wjsonfile)
+	sem_cwebp          = sem.New(*flag_b_sem_cwebp)
+	sem_avifenc        = sem.New(*flag_b_sem_avifenc)
+	sem_deepzoom       = sem.New(*flag_g_sem_deepzoom)
+	sem_opj_decompress = sem.New(*flag_b_sem_opj_decompress)
+	sem_soffice        = sem.New(*flag_b_sem_soffice)
 
 	// Channels
 	ch_ImportedRow       = sch.NewSmartChan(channel_buffer_size)
@@ -232,6 +282,118 @@ type ResultData struct {
 	TotalPages        int64                  `json:"total_pages"`
 	Info              PDFCPUInfoResponseInfo `json:"info"`
 	Metadata          map[string]string      `json:"metadata"`
+	Keywords          []Keyword              `json:"keywords,omitempty"`
+	SimHash           string                 `json:"simhash,omitempty"`
+	MinHash           []uint64               `json:"minhash,omitempty"`
+	Duplicates        []Duplicate            `json:"duplicates,omitempty"`
+	DuplicateOf       string                 `json:"duplicate_of,omitempty"`
+	Status            string                 `json:"status,omitempty"`
+	Encrypted         bool                   `json:"encrypted,omitempty"`
+	EncryptedPDFPath  string                 `json:"encrypted_pdf_path,omitempty"`
+	TableOfContents   []TableOfContents      `json:"table_of_contents,omitempty"`
+	Attachments       []Attachment           `json:"attachments,omitempty"`
+	ParentIdentifier  string                 `json:"parent_identifier,omitempty"`
+	ParentRecordPath  string                 `json:"parent_record_path,omitempty"`
+	Signatures        *SignatureReport       `json:"signatures,omitempty"`
+	Sources           []string               `json:"sources,omitempty"`
+	Download          *DownloadInfo          `json:"download,omitempty"`
+	PublisherChecksum *PublisherChecksum     `json:"publisher_checksum,omitempty"`
+}
+
+// PublisherChecksum is the comparison of a file to the checksum that the manifest of its publisher provides
+type PublisherChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+	Verified  bool   `json:"verified"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// DownloadInfo describes the download of a file so it can be resumed or fetched again only when it changed
+type DownloadInfo struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Bytes        int64     `json:"bytes"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// SignatureReport is the offline validation of the digital signatures of a PDF as it was imported
+type SignatureReport struct {
+	Authentic   bool           `json:"authentic"`
+	ValidatedAt time.Time      `json:"validated_at"`
+	Signatures  []PDFSignature `json:"signatures"`
+}
+
+type PDFSignature struct {
+	Type             string                 `json:"type"`
+	Signed           bool                   `json:"signed"`
+	Certified        bool                   `json:"certified"`
+	Visible          bool                   `json:"visible"`
+	Page             int                    `json:"page,omitempty"`
+	Status           string                 `json:"status"`
+	Reason           string                 `json:"reason"`
+	DocumentModified string                 `json:"document_modified"`
+	Signer           string                 `json:"signer,omitempty"`
+	SignerName       string                 `json:"signer_name,omitempty"`
+	Location         string                 `json:"location,omitempty"`
+	ContactInfo      string                 `json:"contact_info,omitempty"`
+	SigningReason    string                 `json:"signing_reason,omitempty"`
+	SigningTime      *time.Time             `json:"signing_time,omitempty"`
+	Timestamp        *time.Time             `json:"timestamp,omitempty"`
+	Certificates     []SignatureCertificate `json:"certificates,omitempty"`
+	Problems         []string               `json:"problems,omitempty"`
+}
+
+// SignatureCertificate is a certificate of the chain of a signature, starting with the signer
+type SignatureCertificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	ValidFrom    time.Time `json:"valid_from"`
+	ValidThru    time.Time `json:"valid_thru"`
+	Expired      bool      `json:"expired"`
+	SelfSigned   bool      `json:"self_signed"`
+	Trusted      string    `json:"trusted"`
+	Revocation   string    `json:"revocation"`
+}
+
+// TableOfContents is an entry of the outline (bookmarks) of a PDF
+type TableOfContents struct {
+	Title    string            `json:"title"`
+	Page     int               `json:"page"`
+	Children []TableOfContents `json:"children,omitempty"`
+}
+
+// Annotation is a comment, highlight, link or other annotation of a page
+type Annotation struct {
+	Identifier string `json:"identifier,omitempty"`
+	Type       string `json:"type"`
+	Rect       string `json:"rect,omitempty"`
+	Contents   string `json:"contents,omitempty"`
+}
+
+// Attachment is a file embedded in a PDF; PDF attachments are imported as child documents at RecordPath
+type Attachment struct {
+	FileName    string     `json:"filename"`
+	Description string     `json:"description,omitempty"`
+	ModifiedAt  *time.Time `json:"modified_at,omitempty"`
+	Path        string     `json:"path"`
+	Bytes       int64      `json:"bytes"`
+	RecordPath  string     `json:"record_path,omitempty"`
+}
+
+type Duplicate struct {
+	Identifier   string  `json:"identifier"`
+	RecordPath   string  `json:"record_path,omitempty"`
+	ManifestPath string  `json:"manifest_path,omitempty"`
+	Similarity   float64 `json:"similarity"`
+}
+
+type Keyword struct {
+	Term  string  `json:"term"`
+	Score float64 `json:"score"`
 }
 
 type JPEG struct {
@@ -244,29 +406,87 @@ type PNG struct {
 	Dark  Images `json:"dark"`
 }
 
+type WEBP struct {
+	Light Images `json:"light"`
+	Dark  Images `json:"dark"`
+}
+
+type AVIF struct {
+	Light Images `json:"light"`
+	Dark  Images `json:"dark"`
+}
+
 type PendingPage struct {
-	Identifier       string      `json:"identifier"`
-	RecordIdentifier string      `json:"record_identifier"`
-	PageNumber       int         `json:"page_number"`
-	PDFPath          string      `json:"pdf_path"`
-	PagesDir         string      `json:"pages_dir"`
-	OCRTextPath      string      `json:"ocr_text_path"`
-	ManifestPath     string      `json:"manifest_path"`
-	Language         string      `json:"language"`
-	Cryptonyms       []string    `json:"cryptonyms"`
-	Dates            []time.Time `json:"dates"`
-	JPEG             JPEG        `json:"jpeg"`
-	PNG              PNG         `json:"png"`
+	Identifier       string          `json:"identifier"`
+	RecordIdentifier string          `json:"record_identifier"`
+	PageNumber       int             `json:"page_number"`
+	PDFPath          string          `json:"pdf_path"`
+	PagesDir         string          `json:"pages_dir"`
+	OCRTextPath      string          `json:"ocr_text_path"`
+	ManifestPath     string          `json:"manifest_path"`
+	Language         string          `json:"language"`
+	Cryptonyms       []string        `json:"cryptonyms"`
+	Dates            []time.Time     `json:"dates"`
+	Keywords         []Keyword       `json:"keywords,omitempty"`
+	SimHash          string          `json:"simhash,omitempty"`
+	Duplicates       []Duplicate     `json:"duplicates,omitempty"`
+	PHash            string          `json:"phash,omitempty"`
+	DHash            string          `json:"dhash,omitempty"`
+	Cluster          string          `json:"cluster,omitempty"`
+	SharedImagesWith string          `json:"shared_images_with,omitempty"`
+	Blank            bool            `json:"blank"`
+	InkCoverage      float64         `json:"ink_coverage"`
+	Orientation      PageOrientation `json:"orientation"`
+	JPEG             JPEG            `json:"jpeg"`
+	PNG              PNG             `json:"png"`
+	WEBP             WEBP            `json:"webp"`
+	AVIF             AVIF            `json:"avif"`
+	DeepZoom         DeepZoom        `json:"deep_zoom"`
+	IIIF             IIIFImage       `json:"iiif"`
+	Renditions       Renditions      `json:"renditions"`
+	Annotations      []Annotation    `json:"annotations,omitempty"`
 }
 
-type Images struct {
-	Original string `json:"original"`
-	Large    string `json:"large"`
-	Medium   string `json:"medium"`
-	Small    string `json:"small"`
-	Social   string `json:"social"`
+// Renditions describes every rendition of each theme by its name
+type Renditions struct {
+	Light map[string]Rendition `json:"light"`
+	Dark  map[string]Rendition `json:"dark"`
 }
 
+type Rendition struct {
+	Width         int             `json:"width"`
+	Height        int             `json:"height"`
+	DPI           float64         `json:"dpi"`
+	BlurHash      string          `json:"blurhash,omitempty"`
+	LQIP          string          `json:"lqip,omitempty"`
+	DominantColor string          `json:"dominant_color,omitempty"`
+	Files         []RenditionFile `json:"files,omitempty"`
+}
+
+// RenditionFile is one encoded image of a rendition that an integrity check can verify without decoding it
+type RenditionFile struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// DeepZoom holds the path of the .dzi descriptor of each theme; the tiles are in the <name>_files directory next to it
+type DeepZoom struct {
+	Light string `json:"light,omitempty"`
+	Dark  string `json:"dark,omitempty"`
+}
+
+type PageOrientation struct {
+	Rotation   int     `json:"rotation"`   // clockwise degrees the rendered page was rotated
+	Skew       float64 `json:"skew"`       // counter-clockwise degrees the rendered page was deskewed
+	Confidence float64 `json:"confidence"` // tesseract OSD orientation confidence
+	Method     string  `json:"method,omitempty"`
+}
+
+// Images maps the rendition name ("original" or the name of a RenditionProfile) to the path of its image
+type Images map[string]string
+
 type Column struct {
 	Header string
 	Value  string
@@ -0,0 +1,149 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pixiv/go-libjpeg/jpeg"
+)
+
+// dziLevels returns the number of levels of a Deep Zoom pyramid; the last level is the full resolution image and
+// every level before it is half the size down to a single pixel
+func dziLevels(width, height int) int {
+	return int(math.Ceil(math.Log2(float64(max(width, height))))) + 1
+}
+
+// dziTileBounds returns the rectangle of tile (col, row) of a level that is width x height; tiles overlap their
+// neighbours by overlap pixels on every side that has a neighbour
+func dziTileBounds(col, row, width, height, tileSize, overlap int) image.Rectangle {
+	x0, y0 := col*tileSize, row*tileSize
+	if col > 0 {
+		x0 -= overlap
+	}
+	if row > 0 {
+		y0 -= overlap
+	}
+	x1 := min(width, (col+1)*tileSize+overlap)
+	y1 := min(height, (row+1)*tileSize+overlap)
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// writeDeepZoom cuts img into the Deep Zoom Image (DZI) pyramid <base>.dzi + <base>_files/<level>/<col>_<row>.jpg
+func writeDeepZoom(img image.Image, base string, tileSize, overlap, quality int) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return fmt.Errorf("cannot tile an empty image into %v", base)
+	}
+
+	tilesDir := base + "_files"
+	levels := dziLevels(width, height)
+	level := imaging.Clone(img)
+	for l := levels - 1; l >= 0; l-- {
+		scale := math.Pow(2, float64(levels-1-l))
+		levelWidth := max(1, int(math.Ceil(float64(width)/scale)))
+		levelHeight := max(1, int(math.Ceil(float64(height)/scale)))
+		if level.Bounds().Dx() != levelWidth || level.Bounds().Dy() != levelHeight {
+			level = imaging.Resize(level, levelWidth, levelHeight, imaging.Lanczos)
+		}
+
+		levelDir := filepath.Join(tilesDir, fmt.Sprint(l))
+		err := os.MkdirAll(levelDir, 0755)
+		if err != nil {
+			return err
+		}
+		for row := 0; row*tileSize < levelHeight; row++ {
+			for col := 0; col*tileSize < levelWidth; col++ {
+				tile := imaging.Crop(level, dziTileBounds(col, row, levelWidth, levelHeight, tileSize, overlap))
+				err := writeJpegTile(nrgbaToRGBA(tile), filepath.Join(levelDir, fmt.Sprintf("%d_%d.jpg", col, row)), quality)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	descriptor := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="jpg" Overlap="%d" TileSize="%d">
+    <Size Width="%d" Height="%d"/>
+</Image>
+`, overlap, tileSize, width, height)
+	return write_string_to_file(base+".dzi", descriptor)
+}
+
+// writeJpegTile encodes a single tile with go-libjpeg
+func writeJpegTile(img image.Image, path string, quality int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = jpeg.Encode(file, img, &jpeg.EncoderOptions{Quality: quality, OptimizeCoding: true})
+	close_err := file.Close()
+	if err != nil {
+		return err
+	}
+	return close_err
+}
+
+// generateDeepZoom cuts the PNG original of both themes of pp into a DZI tile pyramid with --deep-zoom and records
+// the .dzi descriptors in pp.DeepZoom; it must run before the PNG originals are removed
+func generateDeepZoom(pp PendingPage) PendingPage {
+	if !*flag_b_deep_zoom || skipBlankPage(pp, c_blank_step_thumbnails) {
+		return pp
+	}
+	for _, theme := range []string{c_theme_light, c_theme_dark} {
+		original := pp.PNG.Light[c_rendition_original]
+		if theme == c_theme_dark {
+			original = pp.PNG.Dark[c_rendition_original]
+		}
+		descriptor := strings.TrimSuffix(original, ".original.png") + ".dzi"
+		if _, err := os.Stat(descriptor); os.IsNotExist(err) {
+			file, err := os.Open(original)
+			if err != nil {
+				log_error.Tracef("failed to open %v for deep zoom tiling due to error %v", original, err)
+				continue
+			}
+			img, err := imaging.Decode(file)
+			_ = file.Close()
+			if err != nil {
+				log_error.Tracef("failed to decode %v for deep zoom tiling due to error %v", original, err)
+				continue
+			}
+			sem_deepzoom.Acquire()
+			err = writeDeepZoom(img, strings.TrimSuffix(descriptor, ".dzi"), *flag_i_deep_zoom_tile_size, *flag_i_deep_zoom_overlap, *flag_g_jpg_quality)
+			sem_deepzoom.Release()
+			if err != nil {
+				log_error.Tracef("failed to write the deep zoom pyramid %v due to error %v", descriptor, err)
+				continue
+			}
+		}
+		if theme == c_theme_dark {
+			pp.DeepZoom.Dark = descriptor
+		} else {
+			pp.DeepZoom.Light = descriptor
+		}
+	}
+	return pp
+}
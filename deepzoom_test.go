@@ -0,0 +1,68 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func Test_dziTileBounds(t *testing.T) {
+	tests := []struct {
+		col, row int
+		want     image.Rectangle
+	}{
+		{0, 0, image.Rect(0, 0, 255, 255)},
+		{1, 0, image.Rect(253, 0, 509, 255)},
+		{3, 1, image.Rect(761, 253, 1000, 509)},
+	}
+	for _, tt := range tests {
+		if got := dziTileBounds(tt.col, tt.row, 1000, 600, 254, 1); got != tt.want {
+			t.Errorf("dziTileBounds(%d, %d) = %v, want %v", tt.col, tt.row, got, tt.want)
+		}
+	}
+}
+
+func Test_writeDeepZoom(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "page.light.000001")
+	img := imaging.New(600, 300, color.White)
+	if err := writeDeepZoom(img, base, 254, 1, 80); err != nil {
+		t.Fatalf("writeDeepZoom() error = %v", err)
+	}
+	if levels := dziLevels(600, 300); levels != 11 {
+		t.Errorf("dziLevels(600, 300) = %d, want 11", levels)
+	}
+	descriptor, err := os.ReadFile(base + ".dzi")
+	if err != nil || !strings.Contains(string(descriptor), `<Size Width="600" Height="300"/>`) {
+		t.Errorf("writeDeepZoom() descriptor = %s, %v", descriptor, err)
+	}
+	for _, tile := range []string{"10/2_1.jpg", "9/1_0.jpg", "0/0_0.jpg"} {
+		if _, err := os.Stat(filepath.Join(base+"_files", tile)); err != nil {
+			t.Errorf("writeDeepZoom() did not write tile %v: %v", tile, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(base+"_files", "10", "3_0.jpg")); err == nil {
+		t.Errorf("writeDeepZoom() wrote a tile outside of the image")
+	}
+}
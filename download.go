@@ -0,0 +1,255 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDownloadIncomplete = errors.New("download is incomplete")
+	ErrDownloadTooLarge   = errors.New("download is larger than --max-download-mb")
+	ErrDownloadType       = errors.New("download is not the expected type of file")
+)
+
+// HTTPStatusError is returned for a download whose response has an unexpected status code
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // how long the server asked to wait before trying again
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("GET %v returned %v (retry after %v)", e.URL, e.Status, e.RetryAfter)
+	}
+	return fmt.Sprintf("GET %v returned %v", e.URL, e.Status)
+}
+
+// Temporary returns true for the responses of an overloaded or rate limiting server that are worth retrying
+func (e *HTTPStatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// download_info_path is the sidecar that keeps the validators of the download of output
+func download_info_path(output string) string {
+	return output + ".download.json"
+}
+
+// read_download_info returns the DownloadInfo saved for output, or nil when it was not downloaded
+func read_download_info(output string) *DownloadInfo {
+	data, err := os.ReadFile(download_info_path(output))
+	if err != nil {
+		return nil
+	}
+	var info DownloadInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+func write_download_info(output string, info DownloadInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(download_info_path(output), data, 0640)
+}
+
+// accepted_download_type returns true when a response of media_type can be saved to output: PDFs and generic binary
+// responses always, images when output is a scanned image; never HTML error or login pages
+func accepted_download_type(media_type string, output string) bool {
+	switch media_type {
+	case "", "application/pdf", "application/x-pdf", "application/octet-stream", "binary/octet-stream",
+		"application/download", "application/force-download", "application/x-download":
+		return true
+	}
+	return strings.HasPrefix(media_type, "image/") && isScanImage(output)
+}
+
+// content_range_start returns the first byte and the total size of a Content-Range header; the size is -1 when the
+// server does not know it
+func content_range_start(content_range string) (start int64, total int64, err error) {
+	var end int64
+	var size string
+	if _, err = fmt.Sscanf(content_range, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", content_range)
+	}
+	if size == "*" {
+		return start, -1, nil
+	}
+	total, err = strconv.ParseInt(size, 10, 64)
+	return start, total, err
+}
+
+// download_to downloads link into <output>.part and renames it to output once it is complete. A .part left by an
+// earlier attempt is resumed with a Range request that is only honoured while the ETag or Last-Modified of the file
+// is unchanged. When output exists it is fetched again only if the server reports that it changed. The response
+// must be a PDF, a binary file or the image output names, no larger than max_bytes and as long as the server said
+func download_to(ctx context.Context, client *http.Client, link string, output string, max_bytes int64) error {
+	part := output + ".part"
+	previous := read_download_info(output)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	if stat, err := os.Stat(part); err == nil && stat.Size() > 0 {
+		offset = stat.Size()
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if previous != nil && len(previous.ETag) > 0 && !strings.HasPrefix(previous.ETag, "W/") {
+			request.Header.Set("If-Range", previous.ETag)
+		} else if previous != nil && len(previous.LastModified) > 0 {
+			request.Header.Set("If-Range", previous.LastModified)
+		}
+	} else if _, err := os.Stat(output); err == nil && previous != nil {
+		if len(previous.ETag) > 0 {
+			request.Header.Set("If-None-Match", previous.ETag)
+		}
+		if len(previous.LastModified) > 0 {
+			request.Header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+
+	if err := polite_request(ctx, client, request); err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	total := response.ContentLength
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+		offset = 0 // the server sent the whole file because the range was ignored or the file changed
+	case http.StatusPartialContent:
+		start, size, range_err := content_range_start(response.Header.Get("Content-Range"))
+		if range_err != nil || start != offset {
+			_ = os.Remove(part)
+			return fmt.Errorf("%w: %v resumed at the wrong offset (%v)", ErrDownloadIncomplete, link, range_err)
+		}
+		total, flags = size, os.O_WRONLY|os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		_ = os.Remove(part)
+		return fmt.Errorf("%w: %v cannot be resumed at byte %d", ErrDownloadIncomplete, link, offset)
+	default:
+		status_err := &HTTPStatusError{
+			URL:        link,
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			RetryAfter: parse_retry_after(response.Header.Get("Retry-After"), time.Now()),
+		}
+		if status_err.Temporary() && status_err.RetryAfter > 0 {
+			pause_host(request.URL.Host, status_err.RetryAfter)
+		}
+		return status_err
+	}
+
+	media_type, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if !accepted_download_type(media_type, output) {
+		_ = os.Remove(part)
+		return fmt.Errorf("%w: %v returned %v", ErrDownloadType, link, media_type)
+	}
+	if total > max_bytes {
+		_ = os.Remove(part)
+		return fmt.Errorf("%w: %v is %d bytes", ErrDownloadTooLarge, link, total)
+	}
+	info := DownloadInfo{
+		URL:          link,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		ContentType:  media_type,
+		Bytes:        total,
+	}
+	if response.StatusCode == http.StatusPartialContent && previous != nil {
+		info.ContentType = previous.ContentType
+	}
+	if err := write_download_info(output, info); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(part, flags, 0640)
+	if err != nil {
+		return err
+	}
+	written, copy_err := io.Copy(file, io.LimitReader(response.Body, max_bytes-offset+1))
+	close_err := file.Close()
+	written += offset
+	if written > max_bytes {
+		_ = os.Remove(part)
+		return fmt.Errorf("%w: %v is more than %d bytes", ErrDownloadTooLarge, link, max_bytes)
+	}
+	if copy_err != nil {
+		return fmt.Errorf("%w: %v stopped at byte %d: %v", ErrDownloadIncomplete, link, written, copy_err)
+	}
+	if close_err != nil {
+		return close_err
+	}
+	if total >= 0 && written != total {
+		if written > total {
+			_ = os.Remove(part)
+		}
+		return fmt.Errorf("%w: %v is %d of %d bytes", ErrDownloadIncomplete, link, written, total)
+	}
+	if strings.EqualFold(filepath.Ext(output), ".pdf") && !has_pdf_header(part) {
+		_ = os.Remove(part)
+		return fmt.Errorf("%w: %v is not a pdf", ErrDownloadType, link)
+	}
+
+	if err := os.Rename(part, output); err != nil {
+		return err
+	}
+	info.Bytes, info.DownloadedAt = written, time.Now().UTC()
+	return write_download_info(output, info)
+}
+
+// has_pdf_header returns true when the %PDF- header is in the first kilobyte of the file at path
+func has_pdf_header(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, 1024)
+	n, _ := io.ReadFull(file, header)
+	return bytes.Contains(header[:n], []byte("%PDF-"))
+}
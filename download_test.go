@@ -0,0 +1,100 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_download_to(t *testing.T) {
+	defer func(rps float64) { *flag_f_host_rps = rps }(*flag_f_host_rps)
+	*flag_f_host_rps = 0
+
+	body := testPDF(40)
+	modified := time.Date(2004, 5, 17, 0, 0, 0, 0, time.UTC)
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		switch r.URL.Path {
+		case "/login.pdf":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>please log in</html>"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("ETag", `"v1"`)
+		if len(requests) == 1 { // the connection drops halfway through the first download
+			w.Header().Set("Content-Length", "999999")
+			_, _ = w.Write(body[:len(body)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "memo.pdf", modified, bytes.NewReader(body))
+	}))
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "memo.pdf")
+	err := download_to(context.Background(), server.Client(), server.URL+"/memo.pdf", output, 1<<20)
+	if !errors.Is(err, ErrDownloadIncomplete) {
+		t.Fatalf("download_to() with a dropped connection = %v, want ErrDownloadIncomplete", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("download_to() left an incomplete %v", output)
+	}
+
+	if err := download_to(context.Background(), server.Client(), server.URL+"/memo.pdf", output, 1<<20); err != nil {
+		t.Fatalf("download_to() resume error = %v", err)
+	}
+	if requests[1].Header.Get("Range") != fmt.Sprintf("bytes=%d-", len(body)/2) || requests[1].Header.Get("If-Range") != `"v1"` {
+		t.Errorf("download_to() resumed with Range %q and If-Range %q", requests[1].Header.Get("Range"), requests[1].Header.Get("If-Range"))
+	}
+	if data, err := os.ReadFile(output); err != nil || !bytes.Equal(data, body) {
+		t.Errorf("download_to() resumed into %d bytes, want %d", len(data), len(body))
+	}
+	if _, err := os.Stat(output + ".part"); !os.IsNotExist(err) {
+		t.Errorf("download_to() did not rename the .part file")
+	}
+	info := read_download_info(output)
+	if info == nil || info.ETag != `"v1"` || info.LastModified != modified.Format(http.TimeFormat) || info.Bytes != int64(len(body)) {
+		t.Errorf("read_download_info() = %+v", info)
+	}
+
+	// fetching again only downloads the file when it changed
+	if err := download_to(context.Background(), server.Client(), server.URL+"/memo.pdf", output, 1<<20); err != nil {
+		t.Errorf("download_to() refetch error = %v", err)
+	}
+	if requests[2].Header.Get("If-None-Match") != `"v1"` {
+		t.Errorf("download_to() refetched without If-None-Match")
+	}
+
+	if err := download_to(context.Background(), server.Client(), server.URL+"/login.pdf", filepath.Join(t.TempDir(), "login.pdf"), 1<<20); !errors.Is(err, ErrDownloadType) {
+		t.Errorf("download_to(html) = %v, want ErrDownloadType", err)
+	}
+	if err := download_to(context.Background(), server.Client(), server.URL+"/memo.pdf", filepath.Join(t.TempDir(), "big.pdf"), 100); !errors.Is(err, ErrDownloadTooLarge) {
+		t.Errorf("download_to(too large) = %v, want ErrDownloadTooLarge", err)
+	}
+}
@@ -0,0 +1,319 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// read_result_data loads a record.json file from the database directory
+func read_result_data(path string) (ResultData, error) {
+	var rd ResultData
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rd, err
+	}
+	err = json.Unmarshal(data, &rd)
+	if err != nil {
+		return rd, err
+	}
+	if len(rd.RecordPath) == 0 {
+		rd.RecordPath = path
+	}
+	return rd, nil
+}
+
+// read_pending_page loads a page.######.json manifest from the database directory
+func read_pending_page(path string) (PendingPage, error) {
+	var pp PendingPage
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pp, err
+	}
+	err = json.Unmarshal(data, &pp)
+	if err != nil {
+		return pp, err
+	}
+	if len(pp.ManifestPath) == 0 {
+		pp.ManifestPath = path
+	}
+	return pp, nil
+}
+
+// database_records loads every <checksum>/record.json inside the --database-directory
+func database_records() []ResultData {
+	paths, err := filepath.Glob(filepath.Join(*flag_s_database_directory, "*", "record.json"))
+	if err != nil {
+		log_error.Tracef("failed to glob the record.json files of %v due to error %v", *flag_s_database_directory, err)
+		return nil
+	}
+	records := make([]ResultData, 0, len(paths))
+	for _, path := range paths {
+		rd, rd_err := read_result_data(path)
+		if rd_err != nil {
+			log_debug.Printf("skipping %v because it cannot be read: %v", path, rd_err)
+			continue
+		}
+		records = append(records, rd)
+	}
+	return records
+}
+
+// find_duplicate_pdf returns the RecordPath of an existing record whose PDFChecksum matches checksum; the
+// database directory is indexed on the first call and the records of the current run are checked in sm_resultdatas
+func find_duplicate_pdf(checksum string) (string, bool) {
+	once_pdf_index.Do(func() {
+		records := database_records()
+		mu_pdf_checksums.Lock()
+		defer mu_pdf_checksums.Unlock()
+		for _, rd := range records {
+			if len(rd.PDFChecksum) > 0 && len(rd.DuplicateOf) == 0 {
+				m_pdf_checksums[rd.PDFChecksum] = rd.RecordPath
+			}
+		}
+		log_info.Printf("indexed %d PDF checksums from %v", len(m_pdf_checksums), *flag_s_database_directory)
+	})
+
+	mu_pdf_checksums.RLock()
+	record_path, found := m_pdf_checksums[checksum]
+	mu_pdf_checksums.RUnlock()
+	if found {
+		return record_path, true
+	}
+
+	sm_resultdatas.Range(func(key, value any) bool {
+		rd, ok := value.(ResultData)
+		if ok && rd.PDFChecksum == checksum && len(rd.DuplicateOf) == 0 {
+			record_path, found = rd.RecordPath, true
+			return false
+		}
+		return true
+	})
+	return record_path, found
+}
+
+// skip_duplicate_pdf saves rd as a link to an identical PDF that has already been rendered when --skip-duplicates
+// is used and returns true when the caller must not send rd into ch_ImportedRow
+func skip_duplicate_pdf(rd ResultData) bool {
+	if !*flag_b_skip_duplicates {
+		return false
+	}
+	original_record_path, found := find_duplicate_pdf(rd.PDFChecksum)
+	if !found {
+		return false
+	}
+	rd.DuplicateOf = original_record_path
+	rd.Duplicates = append(rd.Duplicates, Duplicate{RecordPath: original_record_path, Similarity: 1})
+	if original, err := read_result_data(original_record_path); err == nil {
+		rd.Duplicates[len(rd.Duplicates)-1].Identifier = original.Identifier
+	}
+	if original_record_path != rd.RecordPath {
+		err := WriteResultDataToJson(rd)
+		if err != nil {
+			log_error.Tracef("failed to write the duplicate record %v due to error %v", rd.RecordPath, err)
+		}
+	}
+	log_info.Printf("skipping %v because its checksum matches the already rendered %v", rd.PDFPath, original_record_path)
+	return true
+}
+
+// analyze_collection_duplicates fingerprints the OCR text of every page (SimHash) and document (MinHash) of the
+// collection, then links near-duplicates across the whole --database-directory inside record.json and the
+// page.######.json manifests
+func analyze_collection_duplicates(ctx context.Context, pages map[string][]PendingPage) {
+	document_shingles := make(map[string][]string)
+	for record_identifier, record_pages := range pages {
+		for i, pp := range record_pages {
+			if ctx.Err() != nil {
+				return
+			}
+			ocr_text, ocr_err := os.ReadFile(pp.OCRTextPath)
+			if ocr_err != nil {
+				continue
+			}
+			shingles := textShingles(string(ocr_text))
+			if len(shingles) == 0 {
+				continue
+			}
+			pp.SimHash = formatFingerprint(simHash(shingles))
+			record_pages[i] = pp
+			document_shingles[record_identifier] = append(document_shingles[record_identifier], shingles...)
+		}
+	}
+
+	// documents of this run
+	var current []ResultData
+	in_run := make(map[string]bool)
+	for record_identifier, shingles := range document_shingles {
+		data_rd, found := sm_resultdatas.Load(record_identifier)
+		if !found {
+			continue
+		}
+		rd, ok := data_rd.(ResultData)
+		if !ok {
+			continue
+		}
+		rd.SimHash = formatFingerprint(simHash(shingles))
+		rd.MinHash = minHashSignature(shingles)
+		current = append(current, rd)
+		in_run[rd.RecordPath] = true
+	}
+
+	// documents from previous runs in the database directory
+	var previous []ResultData
+	for _, rd := range database_records() {
+		if !in_run[rd.RecordPath] && len(rd.MinHash) > 0 {
+			previous = append(previous, rd)
+		}
+	}
+
+	changed_previous := make(map[int]bool)
+	linked_directories := make(map[string]string) // DataDir => Identifier of documents whose pages are compared
+	for i := range current {
+		for j := i + 1; j < len(current); j++ {
+			similarity := minHashSimilarity(current[i].MinHash, current[j].MinHash)
+			if similarity >= *flag_f_duplicate_similarity {
+				current[i].Duplicates = appendDuplicate(current[i].Duplicates, Duplicate{Identifier: current[j].Identifier, RecordPath: current[j].RecordPath, Similarity: similarity})
+				current[j].Duplicates = appendDuplicate(current[j].Duplicates, Duplicate{Identifier: current[i].Identifier, RecordPath: current[i].RecordPath, Similarity: similarity})
+			}
+		}
+		for j := range previous {
+			similarity := minHashSimilarity(current[i].MinHash, previous[j].MinHash)
+			if similarity >= *flag_f_duplicate_similarity {
+				current[i].Duplicates = appendDuplicate(current[i].Duplicates, Duplicate{Identifier: previous[j].Identifier, RecordPath: previous[j].RecordPath, Similarity: similarity})
+				previous[j].Duplicates = appendDuplicate(previous[j].Duplicates, Duplicate{Identifier: current[i].Identifier, RecordPath: current[i].RecordPath, Similarity: similarity})
+				changed_previous[j] = true
+				linked_directories[previous[j].DataDir] = previous[j].Identifier
+			}
+		}
+	}
+
+	for _, rd := range current {
+		err := WriteResultDataToJson(rd)
+		if err != nil {
+			log_error.Tracef("failed to write the fingerprints of %v into %v due to error %v", rd.Identifier, rd.RecordPath, err)
+			continue
+		}
+		sm_resultdatas.Store(rd.Identifier, rd)
+	}
+	for j := range changed_previous {
+		err := WriteResultDataToJson(previous[j])
+		if err != nil {
+			log_error.Tracef("failed to link the near-duplicate %v due to error %v", previous[j].RecordPath, err)
+		}
+	}
+
+	link_duplicate_pages(pages, linked_directories)
+}
+
+// link_duplicate_pages compares the SimHash of every page of the collection against every other page of the
+// collection and the pages of previously rendered near-duplicate documents. The 64 bits are split into
+// --simhash-distance + 1 bands so two fingerprints within the distance are guaranteed to share one band exactly.
+func link_duplicate_pages(pages map[string][]PendingPage, linked_directories map[string]string) {
+	distance := *flag_i_simhash_distance
+	if distance < 0 {
+		return
+	}
+	bands := distance + 1
+	if bands > 64 {
+		bands = 64
+	}
+	band_width := int(math.Ceil(64 / float64(bands)))
+
+	type candidate struct {
+		pp          PendingPage
+		fingerprint uint64
+	}
+	var candidates []candidate
+	for _, record_pages := range pages {
+		for _, pp := range record_pages {
+			if fingerprint, err := parseFingerprint(pp.SimHash); err == nil && len(pp.SimHash) > 0 {
+				candidates = append(candidates, candidate{pp, fingerprint})
+			}
+		}
+	}
+	current_candidates := len(candidates)
+	for data_dir := range linked_directories {
+		manifests, _ := filepath.Glob(filepath.Join(data_dir, "pages", "page.*.json"))
+		for _, manifest := range manifests {
+			pp, err := read_pending_page(manifest)
+			if err != nil || len(pp.SimHash) == 0 {
+				continue
+			}
+			if fingerprint, err := parseFingerprint(pp.SimHash); err == nil {
+				candidates = append(candidates, candidate{pp, fingerprint})
+			}
+		}
+	}
+
+	index := make(map[[2]uint64][]int)
+	for i, c := range candidates {
+		for band := 0; band < bands; band++ {
+			key := [2]uint64{uint64(band), (c.fingerprint >> uint(band*band_width)) & (1<<uint(band_width) - 1)}
+			index[key] = append(index[key], i)
+		}
+	}
+
+	for i := 0; i < current_candidates; i++ {
+		c := candidates[i]
+		seen := make(map[int]bool)
+		for band := 0; band < bands; band++ {
+			key := [2]uint64{uint64(band), (c.fingerprint >> uint(band*band_width)) & (1<<uint(band_width) - 1)}
+			for _, j := range index[key] {
+				if j == i || seen[j] {
+					continue
+				}
+				seen[j] = true
+				d := hammingDistance(c.fingerprint, candidates[j].fingerprint)
+				if d > distance {
+					continue
+				}
+				c.pp.Duplicates = appendDuplicate(c.pp.Duplicates, Duplicate{
+					Identifier:   candidates[j].pp.Identifier,
+					ManifestPath: candidates[j].pp.ManifestPath,
+					Similarity:   math.Round((1-float64(d)/64)*1e4) / 1e4,
+				})
+			}
+		}
+		candidates[i] = c
+	}
+
+	for i := 0; i < current_candidates; i++ {
+		pp := candidates[i].pp
+		for j, record_page := range pages[pp.RecordIdentifier] {
+			if record_page.Identifier == pp.Identifier {
+				pages[pp.RecordIdentifier][j] = pp
+			}
+		}
+		pp_save(pp)
+	}
+}
+
+// appendDuplicate adds link to links unless the identifier is already linked
+func appendDuplicate(links []Duplicate, link Duplicate) []Duplicate {
+	for _, existing := range links {
+		if existing.Identifier == link.Identifier && existing.RecordPath == link.RecordPath && existing.ManifestPath == link.ManifestPath {
+			return links
+		}
+	}
+	return append(links, link)
+}
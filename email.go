@@ -0,0 +1,548 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EmailMessage is a parsed email that is rendered to a PDF
+type EmailMessage struct {
+	From        []*mail.Address
+	To          []*mail.Address
+	Cc          []*mail.Address
+	Subject     string
+	Date        time.Time
+	MessageID   string
+	Body        string
+	html        bool // Body was converted from the text/html part
+	Attachments []EmailAttachment
+}
+
+// EmailAttachment is a file attached to an EmailMessage
+type EmailAttachment struct {
+	FileName string
+	Data     []byte
+}
+
+var (
+	re_html_hidden = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	re_html_break  = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h[1-6])[^>]*>`)
+	re_html_tag    = regexp.MustCompile(`(?s)<[^>]*>`)
+	re_blank_lines = regexp.MustCompile(`\n{3,}`)
+)
+
+// isEmail returns true for the email and mailbox files that are rendered to PDF before they are imported
+func isEmail(path string) bool {
+	return m_email_extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// parse_email reads the headers, the body and the attachments of the message in r
+func parse_email(r io.Reader) (EmailMessage, error) {
+	message, err := mail.ReadMessage(r)
+	if err != nil {
+		return EmailMessage{}, err
+	}
+	decoder := new(mime.WordDecoder)
+	email := EmailMessage{MessageID: strings.Trim(message.Header.Get("Message-Id"), "<> ")}
+	email.From, _ = message.Header.AddressList("From")
+	email.To, _ = message.Header.AddressList("To")
+	email.Cc, _ = message.Header.AddressList("Cc")
+	if email.Subject, err = decoder.DecodeHeader(message.Header.Get("Subject")); err != nil {
+		email.Subject = message.Header.Get("Subject")
+	}
+	if date, err := message.Header.Date(); err == nil {
+		email.Date = date
+	}
+	err = email_part(&email, textproto.MIMEHeader(message.Header), message.Body)
+	return email, err
+}
+
+// email_part reads one MIME part of a message into email, descending into multipart parts; the text/plain part is
+// preferred over the text/html part of a multipart/alternative message
+func email_part(email *EmailMessage, header textproto.MIMEHeader, body io.Reader) error {
+	media_type, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		media_type, params = "text/plain", map[string]string{}
+	}
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	if strings.HasPrefix(media_type, "multipart/") {
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := email_part(email, part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, disposition_params, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := disposition_params["filename"]
+	if len(filename) == 0 {
+		filename = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case disposition == "attachment" || len(filename) > 0 || media_type == "message/rfc822" ||
+		(!strings.HasPrefix(media_type, "text/") && disposition != "inline"):
+		if len(filename) == 0 {
+			filename = fmt.Sprintf("attachment_%d%v", len(email.Attachments)+1, email_attachment_extension(media_type))
+		}
+		email.Attachments = append(email.Attachments, EmailAttachment{FileName: filename, Data: data})
+	case media_type == "text/plain" && (len(email.Body) == 0 || email.html):
+		email.Body, email.html = decode_charset(data, params["charset"]), false
+	case media_type == "text/html" && len(email.Body) == 0:
+		email.Body, email.html = html_to_text(decode_charset(data, params["charset"])), true
+	}
+	return nil
+}
+
+func email_attachment_extension(media_type string) string {
+	if media_type == "message/rfc822" {
+		return ".eml"
+	}
+	if extensions, err := mime.ExtensionsByType(media_type); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ".bin"
+}
+
+// decode_charset returns data as a string, converting the single byte Latin-1 charsets to UTF-8
+func decode_charset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "us-ascii":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return string(data)
+}
+
+// html_to_text keeps the text of an HTML body with its line breaks
+func html_to_text(body string) string {
+	body = re_html_hidden.ReplaceAllString(body, "")
+	body = re_html_break.ReplaceAllString(body, "\n")
+	body = re_html_tag.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+	return strings.TrimSpace(re_blank_lines.ReplaceAllString(body, "\n\n"))
+}
+
+// email_names returns the display names of the addresses, or the address itself when it has no name
+func email_names(addresses []*mail.Address) string {
+	names := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if len(address.Name) > 0 {
+			names = append(names, address.Name)
+		} else {
+			names = append(names, address.Address)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func email_addresses(addresses []*mail.Address) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		formatted = append(formatted, address.String())
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// email_metadata maps the headers of email into the metadata keys of a record
+func email_metadata(email EmailMessage) map[string]string {
+	metadata := make(map[string]string)
+	set := func(key, value string) {
+		if len(value) > 0 {
+			metadata[key] = value
+		}
+	}
+	set("title", email.Subject)
+	set("from_name", email_names(email.From))
+	set("to_name", email_names(email.To))
+	set("from", email_addresses(email.From))
+	set("to", email_addresses(email.To))
+	set("cc", email_addresses(email.Cc))
+	set("message_id", email.MessageID)
+	if !email.Date.IsZero() {
+		metadata["created_at"] = email.Date.Format("2006-01-02")
+	}
+	return metadata
+}
+
+// email_text is the text of email that is rendered to its PDF: the headers followed by the body
+func email_text(email EmailMessage) string {
+	var text strings.Builder
+	header := func(name, value string) {
+		if len(value) > 0 {
+			fmt.Fprintf(&text, "%-9v%v\n", name+":", value)
+		}
+	}
+	header("From", email_addresses(email.From))
+	header("To", email_addresses(email.To))
+	header("Cc", email_addresses(email.Cc))
+	if !email.Date.IsZero() {
+		header("Date", email.Date.Format(time.RFC1123Z))
+	}
+	header("Subject", email.Subject)
+	if len(email.Attachments) > 0 {
+		names := make([]string, len(email.Attachments))
+		for i, attachment := range email.Attachments {
+			names[i] = attachment.FileName
+		}
+		header("Attached", strings.Join(names, ", "))
+	}
+	text.WriteString("\n")
+	text.WriteString(email.Body)
+	return text.String()
+}
+
+// read_mbox splits the mbox in r into its messages, undoing the >From quoting of the lines in their bodies
+func read_mbox(r io.Reader, visit func(message []byte) error) error {
+	reader := bufio.NewReader(r)
+	var message bytes.Buffer
+	started, blank := false, true
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if blank && bytes.HasPrefix(line, []byte("From ")) {
+				if started && message.Len() > 0 {
+					if visit_err := visit(bytes.Clone(message.Bytes())); visit_err != nil {
+						return visit_err
+					}
+				}
+				message.Reset()
+				started = true
+			} else if started {
+				if quoted := bytes.TrimLeft(line, ">"); len(quoted) < len(line) && bytes.HasPrefix(quoted, []byte("From ")) {
+					line = line[1:]
+				}
+				message.Write(line)
+			}
+			blank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if started && message.Len() > 0 {
+		return visit(message.Bytes())
+	}
+	return nil
+}
+
+const (
+	c_text_pdf_font_size   = 10
+	c_text_pdf_leading     = 12
+	c_text_pdf_margin      = 54
+	c_text_pdf_page_width  = 612
+	c_text_pdf_page_height = 792
+	c_text_pdf_columns     = (c_text_pdf_page_width - 2*c_text_pdf_margin) * 10 / (6 * c_text_pdf_font_size) // Courier is 0.6em wide
+	c_text_pdf_rows        = (c_text_pdf_page_height - 2*c_text_pdf_margin) / c_text_pdf_leading
+)
+
+// wrap_text breaks text into lines of at most columns characters, at spaces where it can
+func wrap_text(text string, columns int) []string {
+	var lines []string
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\t", "    ")
+	for _, paragraph := range strings.Split(text, "\n") {
+		paragraph = strings.TrimRight(paragraph, " \r")
+		for utf8.RuneCountInString(paragraph) > columns {
+			runes := []rune(paragraph)
+			cut := strings.LastIndex(string(runes[:columns+1]), " ")
+			if cut <= 0 {
+				cut = len(string(runes[:columns]))
+			}
+			lines = append(lines, strings.TrimRight(paragraph[:cut], " "))
+			paragraph = strings.TrimLeft(paragraph[cut:], " ")
+		}
+		lines = append(lines, paragraph)
+	}
+	return lines
+}
+
+// m_winansi_runes correlates the typographic characters that WinAnsiEncoding places in 0x80-0x9f to their code
+var m_winansi_runes = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a,
+	'‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// m_text_fallbacks spells the common characters that WinAnsiEncoding lacks with the ones that it has
+var m_text_fallbacks = map[rune]string{
+	'‐': "-", '‑': "-", '‒': "-", '―': "—", '−': "-", '‛': "'", '′': "'", '‟': "\"", '″': "\"", '⁄': "/",
+	'Ł': "L", 'ł': "l", 'Đ': "D", 'đ': "d", 'ı': "i", '→': "->", '←': "<-", '⇒': "=>", '≤': "<=", '≥': ">=",
+	'≠': "!=", '≈': "~", '∙': "·", '●': "•", '▪': "•",
+	'\u2002': " ", '\u2003': " ", '\u2009': " ", '\u200a': " ", '\u202f': " ", '\u2028': " ", '\u2029': " ",
+	'\u200b': "", '\u200c': "", '\u200d': "", '\u2060': "", '\ufeff': "",
+}
+
+// pdf_text_string escapes line into a PDF string in WinAnsiEncoding; the other characters are spelled with
+// m_text_fallbacks or without their accents, and the ones that are left become ?
+func pdf_text_string(line string) string {
+	var out strings.Builder
+	out.WriteByte('(')
+	for _, r := range line {
+		if fallback, found := m_text_fallbacks[r]; found {
+			out.WriteString(strings.TrimSuffix(strings.TrimPrefix(pdf_text_string(fallback), "("), ")"))
+			continue
+		}
+		if r > 0xff && m_winansi_runes[r] == 0 {
+			// ą, č, ő and the other accented letters of Latin Extended are decomposed into their letter and accent
+			if decomposed := []rune(norm.NFD.String(string(r))); len(decomposed) > 1 && decomposed[0] <= 0x7f {
+				r = decomposed[0]
+			}
+		}
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r < 0x20 || (r >= 0x7f && r < 0xa0):
+			out.WriteByte(' ')
+		case r < 0x80:
+			out.WriteRune(r)
+		case r <= 0xff:
+			fmt.Fprintf(&out, "\\%03o", r)
+		case m_winansi_runes[r] > 0:
+			fmt.Fprintf(&out, "\\%03o", m_winansi_runes[r])
+		default:
+			out.WriteByte('?')
+		}
+	}
+	out.WriteByte(')')
+	return out.String()
+}
+
+// write_text_pdf writes text to a PDF at path as Courier on letter pages
+func write_text_pdf(path string, text string) error {
+	lines := wrap_text(text, c_text_pdf_columns)
+	var pages [][]string
+	for len(lines) > c_text_pdf_rows {
+		pages = append(pages, lines[:c_text_pdf_rows])
+		lines = lines[c_text_pdf_rows:]
+	}
+	pages = append(pages, lines)
+
+	// objects 1 catalog, 2 pages, 3 font, then a page and its content stream for each page
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	}
+	kids := make([]string, 0, len(pages))
+	for _, page := range pages {
+		page_object := len(objects) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", page_object))
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", c_text_pdf_font_size, c_text_pdf_leading, c_text_pdf_margin, c_text_pdf_page_height-c_text_pdf_margin-c_text_pdf_font_size)
+		for _, line := range page {
+			fmt.Fprintf(&content, "%v Tj T*\n", pdf_text_string(line))
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", c_text_pdf_page_width, c_text_pdf_page_height, page_object+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%v\nendstream", content.Len(), content.String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%v\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return os.WriteFile(path, out.Bytes(), 0640)
+}
+
+// process_import_email renders every message of the .eml or .mbox file at path to a PDF that is imported with
+// process_import_pdf. The headers of each message become its metadata and its attachments are embedded into its PDF
+// so describe_pdf_contents imports them as child documents
+func process_import_email(ctx context.Context, path string, metadata_json string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	workDir, err := os.MkdirTemp("", "apario-email-")
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	file, err := os.Open(path)
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	defer file.Close()
+	if !strings.EqualFold(filepath.Ext(path), ".mbox") {
+		raw, err := io.ReadAll(file)
+		if err != nil {
+			return log_error.TraceReturn(err)
+		}
+		record_source, _ := ctx.Value(CtxKey("record_source")).(string)
+		if len(record_source) == 0 {
+			record_source = path
+		}
+		return import_email_message(ctx, workDir, raw, name, record_source, metadata_json)
+	}
+
+	if expected, _ := ctx.Value(CtxKey("publisher_checksum")).(string); len(strings.TrimSpace(expected)) > 0 {
+		// the checksum of its publisher is of the mbox, not of its messages, and is verified on a copy of it
+		mbox := filepath.Join(workDir, filepath.Base(path))
+		if err := copy_file(path, mbox); err != nil {
+			return log_error.TraceReturnf("failed to copy %v into %v due to err %v", path, workDir, err)
+		}
+		if ctx, err = check_source_checksum(ctx, mbox, mbox); err != nil {
+			return err
+		}
+	}
+
+	number := 0
+	err = read_mbox(file, func(raw []byte) error {
+		number++
+		message_name := fmt.Sprintf("%v_message_%d", name, number)
+		import_err := import_email_message(ctx, workDir, raw, message_name, path+"#"+strconv.Itoa(number), metadata_json)
+		if import_err != nil {
+			log_error.Tracef("failed to import message %d of %v due to err %v", number, path, import_err)
+		}
+		return nil
+	})
+	if err != nil {
+		return log_error.TraceReturnf("failed to read the mbox %v due to err %v", path, err)
+	}
+	return nil
+}
+
+// import_email_message renders the message raw to <name>.eml.pdf, embeds its attachments and imports it with the raw
+// message kept as <name>.eml in the sources of the record
+func import_email_message(ctx context.Context, workDir string, raw []byte, name, record_source, metadata_json string) error {
+	email, err := parse_email(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(workDir, name)
+	if err := os.MkdirAll(filepath.Join(dir, "attachments"), 0750); err != nil {
+		return err
+	}
+	eml := filepath.Join(dir, name+".eml")
+	if err := os.WriteFile(eml, raw, 0640); err != nil {
+		return err
+	}
+	if !*flag_b_disable_clamav {
+		output, action_taken, clamav_scan_err := scan_path_with_clam_av(eml)
+		if clamav_scan_err != nil {
+			return log_debug.TraceReturnf("while scanning %v clamav scan returned an err: %v", eml, clamav_scan_err)
+		}
+		if action_taken {
+			return log_debug.TraceReturnf("action taken against %v with clamav: %v", eml, output)
+		}
+	}
+
+	pdf := eml + ".pdf"
+	ctx = context.WithValue(ctx, CtxKey("record_source"), record_source)
+	ctx, err = check_source_checksum(ctx, eml, pdf)
+	if err != nil {
+		return err
+	}
+	if err := write_text_pdf(pdf, email_text(email)); err != nil {
+		return err
+	}
+	var attachments []string
+	taken := make(map[string]bool)
+	for i, attachment := range email.Attachments {
+		target := filepath.Join(dir, "attachments", attachment_filename(i, attachment.FileName, taken))
+		if err := os.WriteFile(target, attachment.Data, 0640); err != nil {
+			return err
+		}
+		attachments = append(attachments, target)
+	}
+	if len(attachments) > 0 {
+		sem_pdfcpu.Acquire()
+		err = api.AddAttachmentsFile(pdf, "", attachments, false, pdfcpu_configuration())
+		sem_pdfcpu.Release()
+		if err != nil {
+			return &PDFError{Op: "attach", Path: pdf, Err: err}
+		}
+	}
+
+	metadata := make(map[string]string)
+	if len(metadata_json) > 0 {
+		if err := json.Unmarshal([]byte(metadata_json), &metadata); err != nil {
+			log_debug.Tracef("failed to parse the --metadata-json due to err %v", err)
+		}
+	}
+	message_json, err := merge_metadata_json(metadata, email_metadata(email))
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, CtxKey("sources"), []string{eml})
+	return process_import_pdf(ctx, pdf, message_json)
+}
@@ -0,0 +1,145 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testEmail = "From: \"Allen Dulles\" <dulles@cia.gov>\r\n" +
+	"To: Richard Helms <helms@cia.gov>, ops@cia.gov\r\n" +
+	"Subject: =?UTF-8?Q?Project_=C3=9CLTRA?=\r\n" +
+	"Date: Mon, 13 Apr 1953 09:30:00 -0500\r\n" +
+	"Message-ID: <memo-1@cia.gov>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>html body</p>\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"The program is approved =E2=80=94 proceed.\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"budget.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"budget.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\nLjQK\r\n" +
+	"--outer--\r\n"
+
+func Test_parse_email(t *testing.T) {
+	email, err := parse_email(strings.NewReader(testEmail))
+	if err != nil {
+		t.Fatalf("parse_email() error = %v", err)
+	}
+	if strings.TrimSpace(email.Body) != "The program is approved — proceed." {
+		t.Errorf("parse_email() body = %q, want the text/plain part", email.Body)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0].FileName != "budget.pdf" || string(email.Attachments[0].Data) != "%PDF-1.4\n" {
+		t.Errorf("parse_email() attachments = %+v, want budget.pdf", email.Attachments)
+	}
+	want := map[string]string{
+		"title":      "Project ÜLTRA",
+		"from_name":  "Allen Dulles",
+		"to_name":    "Richard Helms, ops@cia.gov",
+		"from":       `"Allen Dulles" <dulles@cia.gov>`,
+		"to":         `"Richard Helms" <helms@cia.gov>, <ops@cia.gov>`,
+		"message_id": "memo-1@cia.gov",
+		"created_at": "1953-04-13",
+	}
+	if got := email_metadata(email); !reflect.DeepEqual(got, want) {
+		t.Errorf("email_metadata() = %v, want %v", got, want)
+	}
+
+	html, err := parse_email(strings.NewReader("Subject: html\r\nContent-Type: text/html\r\n\r\n<style>p{}</style><p>one &amp; two</p><p>three</p>"))
+	if err != nil || html.Body != "one & two\nthree" {
+		t.Errorf("parse_email(html) body = %q, %v", html.Body, err)
+	}
+}
+
+func Test_read_mbox(t *testing.T) {
+	mbox := "From dulles@cia.gov Mon Apr 13 09:30:00 1953\n" +
+		"Subject: first\n\n>From the director\nbody\n\n" +
+		"From helms@cia.gov Tue Apr 14 10:00:00 1953\n" +
+		"Subject: second\n\n>>From here on\n"
+	var subjects, bodies []string
+	err := read_mbox(strings.NewReader(mbox), func(message []byte) error {
+		email, err := parse_email(strings.NewReader(string(message)))
+		if err != nil {
+			return err
+		}
+		subjects = append(subjects, email.Subject)
+		bodies = append(bodies, email.Body)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read_mbox() error = %v", err)
+	}
+	if !reflect.DeepEqual(subjects, []string{"first", "second"}) {
+		t.Errorf("read_mbox() subjects = %v", subjects)
+	}
+	if len(bodies) == 2 && (bodies[0] != "From the director\nbody\n\n" || bodies[1] != ">From here on\n") {
+		t.Errorf("read_mbox() bodies = %q", bodies)
+	}
+}
+
+func Test_write_text_pdf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memo.eml.pdf")
+	text := "Subject: (draft) \\ Ü €\n" + strings.Repeat("word ", 40) + "\n" + strings.Repeat("line\n", c_text_pdf_rows)
+	if err := write_text_pdf(path, text); err != nil {
+		t.Fatalf("write_text_pdf() error = %v", err)
+	}
+	if err := validate_pdf(path); err != nil {
+		t.Errorf("validate_pdf() error = %v", err)
+	}
+	if response, err := analyze_pdf_path(path); err != nil || response.Infos[0].Pages != 2 {
+		t.Errorf("analyze_pdf_path() = %+v, %v, want 2 pages", response, err)
+	}
+	for _, line := range wrap_text(strings.Repeat("word ", 40), c_text_pdf_columns) {
+		if len(line) > c_text_pdf_columns {
+			t.Errorf("wrap_text() line of %d characters is wider than %d", len(line), c_text_pdf_columns)
+		}
+	}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"(a\\b) Ü €", `(\(a\\b\) \334 \200)`},
+		{"It’s “done” – 3…5 — ok", `(It\222s \223done\224 \226 3\2055 \227 ok)`},
+		{"a‑b → c ≤ d\u200b", `(a-b -> c <= d)`},
+		{"Łódź Dvořák 東京", `(L\363dz Dvor\341k ??)`},
+	}
+	for _, tt := range tests {
+		if got := pdf_text_string(tt.line); got != tt.want {
+			t.Errorf("pdf_text_string(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+	_ = os.Remove(path)
+}
@@ -0,0 +1,131 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const (
+	c_shingle_size      = 3  // words per shingle
+	c_minhash_functions = 64 // length of a MinHash signature
+)
+
+// textShingles lowercases the words of text and returns every run of c_shingle_size consecutive words; OCR text
+// that shifts by a few characters between releases still shares most of its shingles
+func textShingles(text string) []string {
+	words := re_token.FindAllString(strings.ToLower(text), -1)
+	if len(words) < c_shingle_size {
+		if len(words) == 0 {
+			return nil
+		}
+		return []string{strings.Join(words, " ")}
+	}
+	shingles := make([]string, 0, len(words)-c_shingle_size+1)
+	for i := 0; i+c_shingle_size <= len(words); i++ {
+		shingles = append(shingles, strings.Join(words[i:i+c_shingle_size], " "))
+	}
+	return shingles
+}
+
+func fnv64(in string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(in))
+	return hash.Sum64()
+}
+
+// simHash returns the 64-bit Charikar SimHash of the features; near-duplicate texts differ by only a few bits
+func simHash(features []string) uint64 {
+	if len(features) == 0 {
+		return 0
+	}
+	var weights [64]int
+	for _, feature := range features {
+		hash := fnv64(feature)
+		for bit := 0; bit < 64; bit++ {
+			if hash&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return fingerprint
+}
+
+// hammingDistance is the number of bits that differ between two fingerprints
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// minHashSignature returns c_minhash_functions minimum hashes of the features where each hash function is the
+// FNV-64a of the feature mixed with a different odd multiplier and offset
+func minHashSignature(features []string) []uint64 {
+	if len(features) == 0 {
+		return nil
+	}
+	signature := make([]uint64, c_minhash_functions)
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	for _, feature := range features {
+		hash := fnv64(feature)
+		for i := range signature {
+			seed := uint64(i)*0x9E3779B97F4A7C15 + 0x632BE59BD9B4E019
+			mixed := (hash ^ seed) * (seed | 1)
+			mixed ^= mixed >> 31
+			if mixed < signature[i] {
+				signature[i] = mixed
+			}
+		}
+	}
+	return signature
+}
+
+// minHashSimilarity estimates the Jaccard similarity of two feature sets from their MinHash signatures
+func minHashSimilarity(a, b []uint64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	matches := 0
+	for i := range a {
+		if a[i] == b[i] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(a))
+}
+
+func formatFingerprint(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
+
+func parseFingerprint(in string) (uint64, error) {
+	return strconv.ParseUint(in, 16, 64)
+}
@@ -0,0 +1,44 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_nearDuplicateFingerprints(t *testing.T) {
+	original := strings.Repeat("the director of central intelligence met with the warren commission on the matter of oswald in mexico city ", 20)
+	republished := strings.Replace(original, "mexico city", "mexico clty", 2)
+	unrelated := strings.Repeat("minutes of the board of supervisors regarding the county budget and road maintenance schedule for spring ", 20)
+
+	a, b, c := textShingles(original), textShingles(republished), textShingles(unrelated)
+
+	if d := hammingDistance(simHash(a), simHash(a)); d != 0 {
+		t.Errorf("Expected identical text to have a SimHash distance of 0, but got %d", d)
+	}
+	if near, far := hammingDistance(simHash(a), simHash(b)), hammingDistance(simHash(a), simHash(c)); near >= far {
+		t.Errorf("Expected the republished text (%d) to be closer than the unrelated text (%d)", near, far)
+	}
+	if s := minHashSimilarity(minHashSignature(a), minHashSignature(a)); s != 1 {
+		t.Errorf("Expected identical text to have a MinHash similarity of 1, but got %v", s)
+	}
+	if near, far := minHashSimilarity(minHashSignature(a), minHashSignature(b)), minHashSimilarity(minHashSignature(a), minHashSignature(c)); near <= far {
+		t.Errorf("Expected the republished text (%v) to be more similar than the unrelated text (%v)", near, far)
+	}
+}
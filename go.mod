@@ -1,6 +1,6 @@
 module apario-writer
 
-go 1.23
+go 1.24.0
 
 require (
 	github.com/andreimerlescu/configurable v0.0.8
@@ -8,14 +8,36 @@ require (
 	github.com/andreimerlescu/go-gematria v0.0.2
 	github.com/andreimerlescu/go-sema v0.0.1
 	github.com/andreimerlescu/go-smartchan v0.0.2
+	github.com/bodgit/sevenzip v1.6.1
 	github.com/disintegration/imaging v1.6.2
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	github.com/pdfcpu/pdfcpu v0.11.1
 	github.com/pixiv/go-libjpeg v0.0.0-20190822045933-3da21a74767d
 	github.com/tealeg/xlsx v1.0.5
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/image v0.32.0
+	golang.org/x/net v0.45.0
+	golang.org/x/text v0.30.0
+	golang.org/x/time v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
 	github.com/go-ini/ini v1.67.0 // indirect
-	golang.org/x/image v0.15.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/hhrutter/lzw v1.0.0 // indirect
+	github.com/hhrutter/pkcs7 v0.2.0 // indirect
+	github.com/hhrutter/tiff v1.0.2 // indirect
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/mattn/go-runewidth v0.0.19 // indirect
+	github.com/pierrec/lz4/v4 v4.1.22 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/spf13/afero v1.11.0 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
+	golang.org/x/crypto v0.43.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
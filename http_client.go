@@ -0,0 +1,245 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HTTPClientProfile is the `http_client` key of the --config file that configures the client of every download and
+// crawl. Durations are Go durations such as 30s or 5m; passwords and tokens may reference environment variables as
+// $NAME or ${NAME}
+type HTTPClientProfile struct {
+	Timeout               string                     `json:"timeout,omitempty" yaml:"timeout"` // whole request, including the body
+	ConnectTimeout        string                     `json:"connect_timeout,omitempty" yaml:"connect_timeout"`
+	TLSHandshakeTimeout   string                     `json:"tls_handshake_timeout,omitempty" yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout string                     `json:"response_header_timeout,omitempty" yaml:"response_header_timeout"`
+	Proxy                 string                     `json:"proxy,omitempty" yaml:"proxy"`           // defaults to HTTPS_PROXY / HTTP_PROXY
+	CAFile                string                     `json:"ca_file,omitempty" yaml:"ca_file"`       // PEM certificates trusted in addition to the system roots
+	CookieJar             string                     `json:"cookie_jar,omitempty" yaml:"cookie_jar"` // cookies.txt in the Netscape format
+	Headers               map[string]string          `json:"headers,omitempty" yaml:"headers"`
+	Hosts                 map[string]HostCredentials `json:"hosts,omitempty" yaml:"hosts"`
+}
+
+// HostCredentials are sent with every request to one host
+type HostCredentials struct {
+	Username    string            `json:"username,omitempty" yaml:"username"`
+	Password    string            `json:"password,omitempty" yaml:"password"`
+	BearerToken string            `json:"bearer_token,omitempty" yaml:"bearer_token"`
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers"`
+}
+
+// profileTransport adds the headers and credentials of an HTTPClientProfile to every request
+type profileTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+	hosts   map[string]HostCredentials
+}
+
+func (t *profileTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	credentials, has_credentials := t.hosts[strings.ToLower(request.URL.Host)]
+	if !has_credentials {
+		credentials, has_credentials = t.hosts[strings.ToLower(request.URL.Hostname())]
+	}
+	if len(t.headers) == 0 && !has_credentials {
+		return t.base.RoundTrip(request)
+	}
+	request = request.Clone(request.Context())
+	for name, value := range t.headers {
+		request.Header.Set(name, value)
+	}
+	if has_credentials {
+		for name, value := range credentials.Headers {
+			request.Header.Set(name, os.ExpandEnv(value))
+		}
+		if len(credentials.Username) > 0 {
+			request.SetBasicAuth(os.ExpandEnv(credentials.Username), os.ExpandEnv(credentials.Password))
+		}
+		if len(credentials.BearerToken) > 0 {
+			request.Header.Set("Authorization", "Bearer "+os.ExpandEnv(credentials.BearerToken))
+		}
+	}
+	return t.base.RoundTrip(request)
+}
+
+// load_http_client builds http_client from the `http_client` key of the --config file; without it the client only
+// gets the default timeouts
+func load_http_client(configFile string) error {
+	var file struct {
+		HTTPClient HTTPClientProfile `json:"http_client" yaml:"http_client"`
+	}
+	if len(configFile) > 0 {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(configFile)) {
+		case ".json":
+			err = json.Unmarshal(data, &file)
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, &file)
+		default:
+			log.Printf("WARNING: using the default http client because the http_client can only be read from a .json, .yaml or .yml --config, not %v", configFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse the http_client of %v: %v", configFile, err)
+		}
+	}
+	client, err := new_http_client(file.HTTPClient)
+	if err != nil {
+		return err
+	}
+	http_client = client
+	return nil
+}
+
+func parse_profile_duration(name, value string, fallback time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("http_client %v %q is not a duration such as 30s", name, value)
+	}
+	return duration, nil
+}
+
+// new_http_client builds the client that profile describes
+func new_http_client(profile HTTPClientProfile) (*http.Client, error) {
+	timeout, err := parse_profile_duration("timeout", profile.Timeout, 0) // the size of a download is limited instead
+	if err != nil {
+		return nil, err
+	}
+	connect_timeout, err := parse_profile_duration("connect_timeout", profile.ConnectTimeout, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	tls_timeout, err := parse_profile_duration("tls_handshake_timeout", profile.TLSHandshakeTimeout, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	header_timeout, err := parse_profile_duration("response_header_timeout", profile.ResponseHeaderTimeout, 2*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connect_timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = tls_timeout
+	transport.ResponseHeaderTimeout = header_timeout
+	if len(profile.Proxy) > 0 {
+		proxy, err := url.Parse(profile.Proxy)
+		if err != nil || len(proxy.Host) == 0 {
+			return nil, fmt.Errorf("http_client proxy %q is not a url", profile.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if len(profile.CAFile) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(profile.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("http_client ca_file %v has no PEM certificates", profile.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	if len(profile.Headers) > 0 || len(profile.Hosts) > 0 {
+		hosts := make(map[string]HostCredentials, len(profile.Hosts))
+		for host, credentials := range profile.Hosts {
+			hosts[strings.ToLower(host)] = credentials
+		}
+		client.Transport = &profileTransport{base: transport, headers: profile.Headers, hosts: hosts}
+	}
+	if len(profile.CookieJar) > 0 {
+		jar, err := load_cookie_jar(profile.CookieJar)
+		if err != nil {
+			return nil, err
+		}
+		client.Jar = jar
+	}
+	return client, nil
+}
+
+// load_cookie_jar reads a cookies.txt in the Netscape format that browsers and curl export
+func load_cookie_jar(path string) (*cookiejar.Jar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		http_only := strings.HasPrefix(line, "#HttpOnly_")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d of the cookie jar %v does not have 7 tab separated fields", number, path)
+		}
+		domain := fields[0]
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: http_only,
+		}
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = domain
+		}
+		if expires, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: strings.TrimPrefix(domain, "."), Path: cookie.Path}, []*http.Cookie{cookie})
+	}
+	return jar, scanner.Err()
+}
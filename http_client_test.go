@@ -0,0 +1,114 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_load_http_client(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		session, _ := r.Cookie("session")
+		fmt.Fprintf(w, "%v|%v:%v|%v|%v", r.Header.Get("X-Collection"), username, password, session.String(), r.Header.Get("X-Archive-Key"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cookies := filepath.Join(dir, "cookies.txt")
+	if err := os.WriteFile(cookies, []byte("# Netscape HTTP Cookie File\n#HttpOnly_127.0.0.1\tFALSE\t/\tTRUE\t0\tsession\tabc123\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APARIO_TEST_PASSWORD", "s3cret")
+	config := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(config, []byte(fmt.Sprintf(`
+http_client:
+  timeout: 1m
+  connect_timeout: 5s
+  ca_file: %v
+  cookie_jar: %v
+  headers:
+    X-Collection: STARGATE
+  hosts:
+    %v:
+      username: foia
+      password: ${APARIO_TEST_PASSWORD}
+      headers:
+        X-Archive-Key: key-1
+`, ca, cookies, host)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(client *http.Client) { http_client = client }(http_client)
+	if err := load_http_client(config); err != nil {
+		t.Fatalf("load_http_client() error = %v", err)
+	}
+	if http_client.Timeout.Minutes() != 1 {
+		t.Errorf("load_http_client() timeout = %v, want 1m", http_client.Timeout)
+	}
+	response, err := http_client.Get(server.URL + "/memo.pdf")
+	if err != nil {
+		t.Fatalf("GET with the ca_file error = %v", err)
+	}
+	defer response.Body.Close()
+	body := make([]byte, 256)
+	n, _ := response.Body.Read(body)
+	if got := string(body[:n]); got != "STARGATE|foia:s3cret|session=abc123|key-1" {
+		t.Errorf("request sent %q, want the headers, credentials and cookie of the profile", got)
+	}
+
+	proxied, err := new_http_client(HTTPClientProfile{Proxy: "http://proxy.example.com:3128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ := http.NewRequest(http.MethodGet, "https://www.cia.gov/readingroom/", nil)
+	if proxy, err := proxied.Transport.(*http.Transport).Proxy(request); err != nil || proxy.String() != (&url.URL{Scheme: "http", Host: "proxy.example.com:3128"}).String() {
+		t.Errorf("proxy = %v, %v", proxy, err)
+	}
+	if _, err := new_http_client(HTTPClientProfile{Timeout: "soon"}); err == nil {
+		t.Errorf("new_http_client() with an invalid timeout did not return an error")
+	}
+
+	ini := filepath.Join(dir, "config.ini")
+	if err := os.WriteFile(ini, []byte("database-directory=/tmp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	err = load_http_client(ini)
+	log.SetOutput(os.Stderr)
+	if err != nil || !strings.Contains(logged.String(), "WARNING") || http_client.Timeout != 0 {
+		t.Errorf("load_http_client(ini) = %v, logged %q, want the default client and a warning", err, logged.String())
+	}
+}
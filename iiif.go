@@ -0,0 +1,376 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	c_iiif_image_context        = "http://iiif.io/api/image/3/context.json"
+	c_iiif_presentation_context = "http://iiif.io/api/presentation/3/context.json"
+)
+
+// IIIFImage is the static IIIF Image API level-0 service of the light original of a page
+type IIIFImage struct {
+	ID       string `json:"id"`
+	InfoPath string `json:"info_path"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+type IIIFLanguageMap map[string][]string
+
+type IIIFMetadata struct {
+	Label IIIFLanguageMap `json:"label"`
+	Value IIIFLanguageMap `json:"value"`
+}
+
+type IIIFImageInfo struct {
+	Context  string      `json:"@context"`
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	Protocol string      `json:"protocol"`
+	Profile  string      `json:"profile"`
+	Width    int         `json:"width"`
+	Height   int         `json:"height"`
+	Tiles    []IIIFTiles `json:"tiles"`
+	Sizes    []IIIFSize  `json:"sizes,omitempty"`
+}
+
+type IIIFTiles struct {
+	Width        int   `json:"width"`
+	ScaleFactors []int `json:"scaleFactors"`
+}
+
+type IIIFSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type IIIFService struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Profile string `json:"profile"`
+}
+
+type IIIFBody struct {
+	ID       string        `json:"id,omitempty"`
+	Type     string        `json:"type"`
+	Format   string        `json:"format,omitempty"`
+	Width    int           `json:"width,omitempty"`
+	Height   int           `json:"height,omitempty"`
+	Value    string        `json:"value,omitempty"`
+	Language string        `json:"language,omitempty"`
+	Service  []IIIFService `json:"service,omitempty"`
+}
+
+type IIIFAnnotation struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	Motivation string   `json:"motivation"`
+	Body       IIIFBody `json:"body"`
+	Target     string   `json:"target"`
+}
+
+type IIIFAnnotationPage struct {
+	ID    string           `json:"id"`
+	Type  string           `json:"type"`
+	Items []IIIFAnnotation `json:"items"`
+}
+
+type IIIFCanvas struct {
+	ID          string               `json:"id"`
+	Type        string               `json:"type"`
+	Label       IIIFLanguageMap      `json:"label"`
+	Width       int                  `json:"width"`
+	Height      int                  `json:"height"`
+	Items       []IIIFAnnotationPage `json:"items"`
+	Annotations []IIIFAnnotationPage `json:"annotations,omitempty"`
+}
+
+type IIIFManifest struct {
+	Context  string          `json:"@context"`
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Label    IIIFLanguageMap `json:"label"`
+	Metadata []IIIFMetadata  `json:"metadata,omitempty"`
+	Items    []IIIFCanvas    `json:"items"`
+}
+
+// iiifURL returns the --iiif-base-url of a path inside the --database-directory
+func iiifURL(path string) (string, error) {
+	relative, err := filepath.Rel(*flag_s_database_directory, path)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(relative, "..") {
+		return "", fmt.Errorf("%v is outside of the database directory", path)
+	}
+	return strings.TrimSuffix(*flag_s_iiif_base_url, "/") + "/" + filepath.ToSlash(relative), nil
+}
+
+// iiifScaleFactors returns the powers of two that the image is tiled at until the whole image fits in a single tile
+func iiifScaleFactors(width, height, tileSize int) []int {
+	factors := []int{1}
+	for factor := 1; int(math.Ceil(float64(max(width, height))/float64(factor))) > tileSize; {
+		factor *= 2
+		factors = append(factors, factor)
+	}
+	return factors
+}
+
+// writeIIIFTiles writes the static IIIF Image API level-0 tiles {region}/{size}/0/default.jpg of img into dir along
+// with its info.json, whose service id is id
+func writeIIIFTiles(img image.Image, dir, id string, tileSize, quality int) (IIIFImageInfo, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	info := IIIFImageInfo{
+		Context:  c_iiif_image_context,
+		ID:       id,
+		Type:     "ImageService3",
+		Protocol: "http://iiif.io/api/image",
+		Profile:  "level0",
+		Width:    width,
+		Height:   height,
+	}
+	if width == 0 || height == 0 {
+		return info, fmt.Errorf("cannot tile an empty image into %v", dir)
+	}
+
+	factors := iiifScaleFactors(width, height, tileSize)
+	info.Tiles = []IIIFTiles{{Width: tileSize, ScaleFactors: factors}}
+	level := imaging.Clone(img)
+	for _, factor := range factors {
+		levelWidth := int(math.Ceil(float64(width) / float64(factor)))
+		levelHeight := int(math.Ceil(float64(height) / float64(factor)))
+		if level.Bounds().Dx() != levelWidth || level.Bounds().Dy() != levelHeight {
+			level = imaging.Resize(level, levelWidth, levelHeight, imaging.Lanczos)
+		}
+		region := tileSize * factor
+		for y := 0; y < height; y += region {
+			for x := 0; x < width; x += region {
+				w, h := min(region, width-x), min(region, height-y)
+				tile := imaging.Crop(level, image.Rect(x/factor, y/factor, min(levelWidth, (x+w+factor-1)/factor), min(levelHeight, (y+h+factor-1)/factor)))
+				size := fmt.Sprintf("%d,%d", tile.Bounds().Dx(), tile.Bounds().Dy())
+				regions := []string{fmt.Sprintf("%d,%d,%d,%d", x, y, w, h)}
+				if w == width && h == height {
+					regions = append(regions, "full")
+					info.Sizes = append(info.Sizes, IIIFSize{Width: tile.Bounds().Dx(), Height: tile.Bounds().Dy()})
+				}
+				for _, r := range regions {
+					tileDir := filepath.Join(dir, r, size, "0")
+					err := os.MkdirAll(tileDir, 0755)
+					if err != nil {
+						return info, err
+					}
+					err = writeJpegTile(nrgbaToRGBA(tile), filepath.Join(tileDir, "default.jpg"), quality)
+					if err != nil {
+						return info, err
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(info.Sizes, func(i, j int) bool { return info.Sizes[i].Width < info.Sizes[j].Width })
+
+	// level 0 requires the full image at its max size, which the manifest paints when there is no original JPEG
+	maxDir := filepath.Join(dir, "full", "max", "0")
+	if err := os.MkdirAll(maxDir, 0755); err != nil {
+		return info, err
+	}
+	if err := writeJpegTile(nrgbaToRGBA(imaging.Clone(img)), filepath.Join(maxDir, "default.jpg"), quality); err != nil {
+		return info, err
+	}
+
+	data, err := json.MarshalIndent(info, "", "    ")
+	if err != nil {
+		return info, err
+	}
+	return info, write_string_to_file(filepath.Join(dir, "info.json"), string(data))
+}
+
+// generateIIIFTiles writes the IIIF level-0 tiles of the light original of pp into <pages>/iiif/######/ when
+// --iiif-base-url is set and records the image service in pp.IIIF; it must run before the PNG original is removed
+func generateIIIFTiles(pp PendingPage) PendingPage {
+	if len(*flag_s_iiif_base_url) == 0 || skipBlankPage(pp, c_blank_step_thumbnails) {
+		return pp
+	}
+	dir := filepath.Join(pp.PagesDir, "iiif", fmt.Sprintf("%06d", pp.PageNumber))
+	id, err := iiifURL(dir)
+	if err != nil {
+		log_error.Tracef("failed to build the IIIF id of %v due to error %v", dir, err)
+		return pp
+	}
+	infoPath := filepath.Join(dir, "info.json")
+	if data, err := os.ReadFile(infoPath); err == nil {
+		var info IIIFImageInfo
+		if json.Unmarshal(data, &info) == nil && info.ID == id {
+			pp.IIIF = IIIFImage{ID: id, InfoPath: infoPath, Width: info.Width, Height: info.Height}
+			return pp
+		}
+	}
+
+	original := pp.PNG.Light[c_rendition_original]
+	file, err := os.Open(original)
+	if err != nil {
+		log_error.Tracef("failed to open %v for IIIF tiling due to error %v", original, err)
+		return pp
+	}
+	img, err := imaging.Decode(file)
+	_ = file.Close()
+	if err != nil {
+		log_error.Tracef("failed to decode %v for IIIF tiling due to error %v", original, err)
+		return pp
+	}
+	sem_deepzoom.Acquire()
+	info, err := writeIIIFTiles(img, dir, id, *flag_i_iiif_tile_size, *flag_g_jpg_quality)
+	sem_deepzoom.Release()
+	if err != nil {
+		log_error.Tracef("failed to write the IIIF tiles of %v due to error %v", original, err)
+		return pp
+	}
+	pp.IIIF = IIIFImage{ID: id, InfoPath: infoPath, Width: info.Width, Height: info.Height}
+	return pp
+}
+
+// write_iiif_manifest writes the IIIF Presentation 3 manifest.json of the document next to its record.json with a
+// canvas for every page in Document.Pages order, the metadata of the record and the OCR text of each page
+func write_iiif_manifest(document Document) error {
+	if len(*flag_s_iiif_base_url) == 0 {
+		return nil
+	}
+	data_rd, found := sm_resultdatas.Load(document.Identifier)
+	if !found {
+		return fmt.Errorf("failed to find the record %v in sm_resultdatas", document.Identifier)
+	}
+	rd, ok := data_rd.(ResultData)
+	if !ok {
+		return fmt.Errorf("failed to typecast the record %v into ResultData", document.Identifier)
+	}
+
+	path := filepath.Join(rd.DataDir, "manifest.json")
+	id, err := iiifURL(path)
+	if err != nil {
+		return err
+	}
+	label := rd.Metadata["title"]
+	if len(label) == 0 {
+		label = strings.TrimSuffix(filepath.Base(rd.PDFPath), filepath.Ext(rd.PDFPath))
+	}
+	manifest := IIIFManifest{
+		Context: c_iiif_presentation_context,
+		ID:      id,
+		Type:    "Manifest",
+		Label:   IIIFLanguageMap{"none": {label}},
+	}
+
+	keys := make([]string, 0, len(rd.Metadata))
+	for key := range rd.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		manifest.Metadata = append(manifest.Metadata, IIIFMetadata{
+			Label: IIIFLanguageMap{"none": {key}},
+			Value: IIIFLanguageMap{"none": {rd.Metadata[key]}},
+		})
+	}
+
+	numbers := make([]int64, 0, len(document.Pages))
+	for number := range document.Pages {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	base := strings.TrimSuffix(id, "/manifest.json")
+	for _, number := range numbers {
+		data_pp, found := sm_pages.Load(document.Pages[number].Identifier)
+		if !found {
+			continue
+		}
+		pp, ok := data_pp.(PendingPage)
+		if !ok || len(pp.IIIF.ID) == 0 {
+			continue
+		}
+		canvas := fmt.Sprintf("%v/canvas/p%d", base, number)
+		body := IIIFBody{
+			ID:      pp.IIIF.ID + "/full/max/0/default.jpg",
+			Type:    "Image",
+			Format:  "image/jpeg",
+			Width:   pp.IIIF.Width,
+			Height:  pp.IIIF.Height,
+			Service: []IIIFService{{ID: pp.IIIF.ID, Type: "ImageService3", Profile: "level0"}},
+		}
+		if original, ok := pp.JPEG.Light[c_rendition_original]; ok {
+			if url, err := iiifURL(original); err == nil {
+				body.ID = url // the original JPEG is painted instead of the full/max copy of the tiles when there is one
+			}
+		}
+		item := IIIFCanvas{
+			ID:     canvas,
+			Type:   "Canvas",
+			Label:  IIIFLanguageMap{"none": {fmt.Sprintf("Page %d", number)}},
+			Width:  pp.IIIF.Width,
+			Height: pp.IIIF.Height,
+			Items: []IIIFAnnotationPage{{
+				ID:   fmt.Sprintf("%v/page/p%d/1", base, number),
+				Type: "AnnotationPage",
+				Items: []IIIFAnnotation{{
+					ID:         fmt.Sprintf("%v/annotation/p%d-image", base, number),
+					Type:       "Annotation",
+					Motivation: "painting",
+					Body:       body,
+					Target:     canvas,
+				}},
+			}},
+		}
+		if text, err := os.ReadFile(pp.OCRTextPath); err == nil && len(strings.TrimSpace(string(text))) > 0 {
+			language := pp.Language
+			if len(language) == 0 {
+				language = "en"
+			}
+			item.Annotations = []IIIFAnnotationPage{{
+				ID:   fmt.Sprintf("%v/page/p%d/2", base, number),
+				Type: "AnnotationPage",
+				Items: []IIIFAnnotation{{
+					ID:         fmt.Sprintf("%v/annotation/p%d-ocr", base, number),
+					Type:       "Annotation",
+					Motivation: "supplementing",
+					Body:       IIIFBody{Type: "TextualBody", Format: "text/plain", Value: strings.TrimSpace(string(text)), Language: language},
+					Target:     canvas,
+				}},
+			}}
+		}
+		manifest.Items = append(manifest.Items, item)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	return write_string_to_file(path, string(data))
+}
@@ -0,0 +1,102 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"encoding/json"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func Test_writeIIIFTiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "000001")
+	info, err := writeIIIFTiles(imaging.New(1000, 600, color.White), dir, "https://example.org/iiif/000001", 512, 80)
+	if err != nil {
+		t.Fatalf("writeIIIFTiles() error = %v", err)
+	}
+	if len(info.Tiles) != 1 || len(info.Tiles[0].ScaleFactors) != 2 || len(info.Sizes) != 1 || info.Sizes[0].Width != 500 {
+		t.Errorf("writeIIIFTiles() info = %+v", info)
+	}
+	for _, tile := range []string{
+		"0,0,512,512/512,512/0/default.jpg",
+		"512,512,488,88/488,88/0/default.jpg",
+		"0,0,1000,600/500,300/0/default.jpg",
+		"full/500,300/0/default.jpg",
+		"full/max/0/default.jpg",
+		"info.json",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, tile)); err != nil {
+			t.Errorf("writeIIIFTiles() did not write %v: %v", tile, err)
+		}
+	}
+}
+
+func Test_write_iiif_manifest(t *testing.T) {
+	database := t.TempDir()
+	base_url, database_directory := *flag_s_iiif_base_url, *flag_s_database_directory
+	*flag_s_iiif_base_url, *flag_s_database_directory = "https://example.org/db/", database
+	defer func() { *flag_s_iiif_base_url, *flag_s_database_directory = base_url, database_directory }()
+
+	recordDir := filepath.Join(database, "record")
+	pagesDir := filepath.Join(recordDir, "pages")
+	if err := os.MkdirAll(pagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	ocr := filepath.Join(pagesDir, "ocr.000001.txt")
+	_ = os.WriteFile(ocr, []byte("TOP SECRET\n"), 0644)
+	sm_resultdatas.Store("iiif-doc", ResultData{Identifier: "iiif-doc", DataDir: recordDir, Metadata: map[string]string{"title": "Stargate", "agency": "CIA"}})
+	sm_pages.Store("iiif-p1", PendingPage{
+		Identifier:  "iiif-p1",
+		PageNumber:  1,
+		OCRTextPath: ocr,
+		JPEG:        JPEG{Light: Images{c_rendition_original: filepath.Join(pagesDir, "page.light.000001.original.jpg")}},
+		IIIF:        IIIFImage{ID: "https://example.org/db/record/pages/iiif/000001", Width: 1000, Height: 600},
+	})
+	defer sm_resultdatas.Delete("iiif-doc")
+	defer sm_pages.Delete("iiif-p1")
+
+	err := write_iiif_manifest(Document{Identifier: "iiif-doc", Pages: map[int64]Page{1: {Identifier: "iiif-p1", PageNumber: 1}}})
+	if err != nil {
+		t.Fatalf("write_iiif_manifest() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(recordDir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest IIIFManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.ID != "https://example.org/db/record/manifest.json" || manifest.Label["none"][0] != "Stargate" || len(manifest.Metadata) != 2 {
+		t.Errorf("write_iiif_manifest() manifest = %+v", manifest)
+	}
+	if len(manifest.Items) != 1 || len(manifest.Items[0].Annotations) != 1 {
+		t.Fatalf("write_iiif_manifest() canvases = %+v", manifest.Items)
+	}
+	painting := manifest.Items[0].Items[0].Items[0]
+	if painting.Body.ID != "https://example.org/db/record/pages/page.light.000001.original.jpg" || painting.Target != manifest.Items[0].ID {
+		t.Errorf("write_iiif_manifest() painting = %+v", painting)
+	}
+	if text := manifest.Items[0].Annotations[0].Items[0].Body.Value; text != "TOP SECRET" {
+		t.Errorf("write_iiif_manifest() OCR annotation = %q", text)
+	}
+}
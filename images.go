@@ -0,0 +1,443 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"golang.org/x/image/tiff"
+)
+
+// isScanImage returns true for the image formats that are imported as scanned pages
+func isScanImage(path string) bool {
+	return m_scan_extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+func isTiff(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".tif" || ext == ".tiff"
+}
+
+// tiffPageOffsets walks the chain of image file directories of a classic TIFF and returns the offset of every page
+func tiffPageOffsets(r io.ReaderAt) ([]uint32, error) {
+	readFull := func(b []byte, off int64) bool {
+		n, _ := r.ReadAt(b, off)
+		return n == len(b)
+	}
+	var header [8]byte
+	if !readFull(header[:], 0) {
+		return nil, errors.New("tiff: file is too short")
+	}
+	var order binary.ByteOrder
+	switch string(header[0:4]) {
+	case "II\x2A\x00":
+		order = binary.LittleEndian
+	case "MM\x00\x2A":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: unsupported header, BigTIFF is not supported")
+	}
+	var offsets []uint32
+	seen := make(map[uint32]bool)
+	var field [4]byte
+	for offset := order.Uint32(header[4:8]); offset != 0; {
+		if seen[offset] || !readFull(field[:2], int64(offset)) {
+			return offsets, fmt.Errorf("tiff: invalid image file directory offset %d", offset)
+		}
+		seen[offset] = true
+		offsets = append(offsets, offset)
+		entries := int64(order.Uint16(field[:2]))
+		if !readFull(field[:4], int64(offset)+2+entries*12) {
+			return offsets, fmt.Errorf("tiff: truncated image file directory at %d", offset)
+		}
+		offset = order.Uint32(field[:4])
+	}
+	return offsets, nil
+}
+
+// tiffPage presents a TIFF to the decoder as if the page at offset was its first image file directory
+type tiffPage struct {
+	r      io.ReaderAt
+	header [8]byte
+	read   int64
+}
+
+func newTiffPage(r io.ReaderAt, offset uint32) (*tiffPage, error) {
+	page := &tiffPage{r: r}
+	if _, err := r.ReadAt(page.header[:], 0); err != nil {
+		return nil, err
+	}
+	if page.header[0] == 'I' {
+		binary.LittleEndian.PutUint32(page.header[4:], offset)
+	} else {
+		binary.BigEndian.PutUint32(page.header[4:], offset)
+	}
+	return page, nil
+}
+
+func (p *tiffPage) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.r.ReadAt(b, off)
+	for i := 0; i < n && off+int64(i) < int64(len(p.header)); i++ {
+		b[i] = p.header[off+int64(i)]
+	}
+	return n, err
+}
+
+func (p *tiffPage) Read(b []byte) (int, error) {
+	n, err := p.ReadAt(b, p.read)
+	p.read += int64(n)
+	return n, err
+}
+
+// decodeScanPages decodes every page of the scanned image at path in order: each image file directory of a TIFF,
+// a JPEG 2000 through opj_decompress, or a single JPEG or PNG
+func decodeScanPages(path string, page func(img image.Image) error) error {
+	if isTiff(path) {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		offsets, err := tiffPageOffsets(file)
+		if len(offsets) == 0 {
+			return err
+		}
+		for _, offset := range offsets {
+			tiff_page, err := newTiffPage(file, offset)
+			if err != nil {
+				return err
+			}
+			img, err := tiff.Decode(tiff_page)
+			if err != nil {
+				return fmt.Errorf("failed to decode the page at offset %d of %v due to error %v", offset, path, err)
+			}
+			if err := page(img); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".jp2" || ext == ".j2k" {
+		decoded := path + ".png"
+		sem_opj_decompress.Acquire()
+		err := runEncoder(m_optional_binaries["opj_decompress"], decoded, "-i", path, "-o", decoded)
+		sem_opj_decompress.Release()
+		if err != nil {
+			return err
+		}
+		defer os.Remove(decoded)
+		path = decoded
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(file)
+	_ = file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode %v due to error %v", path, err)
+	}
+	return page(img)
+}
+
+// tiffPageCount returns the number of pages of the TIFF at path
+func tiffPageCount(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	offsets, err := tiffPageOffsets(file)
+	return len(offsets), err
+}
+
+// naturalLess orders file names with their numbers compared by value so scan_2.jpg comes before scan_10.jpg
+func naturalLess(a, b string) bool {
+	for len(a) > 0 && len(b) > 0 {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if len(da) > 0 && len(db) > 0 {
+			na, _ := strconv.ParseUint(da, 10, 64)
+			nb, _ := strconv.ParseUint(db, 10, 64)
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// scanDocuments groups the scanned images of one directory into documents: every multi-page TIFF is a document of
+// its own and the remaining images are the pages of a single document in natural file name order
+func scanDocuments(paths []string) [][]string {
+	sort.Slice(paths, func(i, j int) bool {
+		return naturalLess(strings.ToLower(filepath.Base(paths[i])), strings.ToLower(filepath.Base(paths[j])))
+	})
+	var documents [][]string
+	var pages []string
+	for _, path := range paths {
+		if isTiff(path) {
+			if count, err := tiffPageCount(path); err == nil && count > 1 {
+				documents = append(documents, []string{path})
+				continue
+			}
+		}
+		pages = append(pages, path)
+	}
+	if len(pages) > 0 {
+		documents = append(documents, pages)
+	}
+	return documents
+}
+
+// scanChecksum returns the SHA-512 checksum of the scanned images at paths in order, which for a single image is the
+// checksum of that file
+func scanChecksum(paths []string) (string, error) {
+	sem_shafile.Acquire()
+	defer sem_shafile.Release()
+	hash := sha512.New()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(hash, file)
+		_ = file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// synthesize_pdf uses pdfcpu to write a PDF with one page per image in order to path
+func synthesize_pdf(images []string, path string) error {
+	_ = os.Remove(path) // pdfcpu appends the pages to an existing PDF
+	imp := pdfcpu.DefaultImportConfig()
+	sem_pdfcpu.Acquire()
+	defer sem_pdfcpu.Release()
+	err := api.ImportImagesFile(images, path, imp, pdfcpu_configuration())
+	if err != nil {
+		return &PDFError{Op: "import", Path: path, Err: err}
+	}
+	return nil
+}
+
+// writeScanOriginal saves img as the PNG original of a page
+func writeScanOriginal(img image.Image, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	err = encoder.Encode(file, img)
+	close_err := file.Close()
+	if err != nil {
+		return err
+	}
+	return close_err
+}
+
+// process_import_images imports the scanned images at sources as one document: the pages of every TIFF and every
+// other image in order. The pages are saved as the PNG originals and sent straight into ch_GeneratePng, while a PDF
+// of the pages is synthesized for download. origin identifies the document: its URL or the path it was imported from
+func process_import_images(ctx context.Context, name string, sources []string, origin string, metadata_json string) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("no images to import for %v", name)
+	}
+	url_checksum := Sha256(origin)
+	identifier := NewIdentifier(6)
+	recordDir := filepath.Join(*flag_s_database_directory, url_checksum)
+	pagesDir := filepath.Join(recordDir, "pages")
+	sourcesDir := filepath.Join(recordDir, "sources")
+	for _, dir := range []string{pagesDir, sourcesDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return log_error.TraceReturnf("cannot mkdir -p %v due to err %v", dir, err)
+		}
+	}
+
+	basename := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	var (
+		q_file_pdf       = filepath.Join(recordDir, strings.ReplaceAll(basename, `/`, `_`)+".pdf")
+		q_file_ocr       = filepath.Join(recordDir, "ocr.txt")
+		q_file_extracted = filepath.Join(recordDir, "extracted.txt")
+		q_file_record    = filepath.Join(recordDir, "record.json")
+	)
+
+	var kept []string
+	for _, source := range sources {
+		kept_source := source
+		if filepath.Dir(source) != recordDir && filepath.Dir(source) != sourcesDir {
+			kept_source = filepath.Join(sourcesDir, filepath.Base(source))
+			if err := copy_file(source, kept_source); err != nil {
+				return log_error.TraceReturnf("failed to copy %v into %v due to err %v", source, sourcesDir, err)
+			}
+		}
+		if !*flag_b_disable_clamav {
+			output, action_taken, clamav_scan_err := scan_path_with_clam_av(kept_source)
+			if clamav_scan_err != nil {
+				return log_debug.TraceReturnf("while scanning %v clamav scan returned an err: %v", kept_source, clamav_scan_err)
+			}
+			if action_taken {
+				return log_debug.TraceReturnf("action taken against %v with clamav: %v", kept_source, output)
+			}
+		}
+		kept = append(kept, kept_source)
+	}
+
+	metadata := make(map[string]string)
+	if len(metadata_json) > 0 {
+		if err := json.Unmarshal([]byte(metadata_json), &metadata); err != nil {
+			log_debug.Tracef("failed to parse the --metadata-json due to err %v", err)
+		}
+	}
+
+	// a synthesized PDF differs on every import, so a scanned document is identified by the checksum of its scans
+	checksum, checksum_err := scanChecksum(kept)
+	if checksum_err != nil {
+		return log_error.TraceReturn(checksum_err)
+	}
+	rd := ResultData{
+		Identifier:        identifier,
+		DataDir:           recordDir,
+		URLChecksum:       url_checksum,
+		PDFChecksum:       checksum,
+		PDFPath:           q_file_pdf,
+		OCRTextPath:       q_file_ocr,
+		ExtractedTextPath: q_file_extracted,
+		RecordPath:        q_file_record,
+		Metadata:          metadata,
+		Sources:           kept,
+	}
+	rd.ParentIdentifier, _ = ctx.Value(CtxKey("parent_identifier")).(string)
+	rd.ParentRecordPath, _ = ctx.Value(CtxKey("parent_record_path")).(string)
+	if strings.HasPrefix(origin, "http") {
+		rd.URL = origin
+	}
+
+	// the checksum of its publisher is of the scanned image that was downloaded or imported, not of the synthesized PDF
+	rd.PublisherChecksum, _ = ctx.Value(CtxKey("source_checksum")).(*PublisherChecksum)
+	if len(kept) == 1 {
+		scan := rd
+		scan.PDFPath = kept[0]
+		verification, verify_err := check_publisher_checksum(ctx, scan)
+		if verify_err != nil {
+			return verify_err
+		}
+		if verification != nil {
+			rd.PublisherChecksum = verification
+		}
+	}
+	if skip_duplicate_pdf(rd) {
+		return nil
+	}
+
+	// every page is written as the PNG original that convertPageToPng would otherwise render with pdftoppm; JPEG and
+	// PNG scans are embedded into the synthesized PDF as they are
+	var pdf_images []string
+	pgNo := 0
+	for _, source := range kept {
+		ext := strings.ToLower(filepath.Ext(source))
+		err := decodeScanPages(source, func(img image.Image) error {
+			pgNo++
+			original := pageImages(pagesDir, c_theme_light, pgNo, c_format_png, "")[c_rendition_original]
+			if err := writeScanOriginal(img, original); err != nil {
+				return err
+			}
+			if ext == ".jpg" || ext == ".jpeg" || ext == ".png" {
+				pdf_images = append(pdf_images, source)
+			} else {
+				pdf_images = append(pdf_images, original)
+			}
+			return nil
+		})
+		if err != nil {
+			return log_error.TraceReturnf("failed to import the pages of %v due to err %v", source, err)
+		}
+	}
+
+	if err := synthesize_pdf(pdf_images, q_file_pdf); err != nil {
+		return log_error.TraceReturn(err)
+	}
+	if err := extract_pdf_pages(q_file_pdf, pagesDir); err != nil {
+		return log_error.TraceReturn(err)
+	}
+	if pdf_analysis, err := analyze_pdf_path(q_file_pdf); err == nil && len(pdf_analysis.Infos) > 0 {
+		rd.Info = pdf_analysis.Infos[0]
+	}
+	rd.TotalPages = int64(pgNo)
+	err := WriteResultDataToJson(rd)
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	sm_resultdatas.Store(identifier, rd)
+	sm_documents.Store(identifier, Document{
+		Identifier: identifier,
+		URL:        rd.URL,
+		Pages:      make(map[int64]Page),
+		TotalPages: int64(pgNo),
+		Collection: Collection{},
+	})
+	sm_page_directories.Store(identifier, pagesDir)
+	a_i_total_pages.Add(int64(pgNo))
+	count_document(ctx)
+
+	pdf_base := strings.TrimSuffix(filepath.Base(q_file_pdf), ".pdf")
+	for page := 1; page <= pgNo; page++ {
+		pp := newPendingPage(rd, pagesDir, filepath.Join(pagesDir, fmt.Sprintf("%v_page_%d.pdf", pdf_base, page)), page)
+		pp_save(pp)
+		log_info.Printf("sending scanned page %d (ID %v) of record %v into the ch_GeneratePng", page, pp.Identifier, identifier)
+		err = ch_GeneratePng.Write(pp)
+		if err != nil {
+			return log_error.TraceReturnf("cannot send pp into ch_GeneratePng channel due to error %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// testTiff returns a TIFF whose pages are solid gray images of the shades, chaining the image file directory of
+// every page onto the one before it
+func testTiff(t *testing.T, shades ...uint8) []byte {
+	var out []byte
+	previous := -1 // position of the next IFD offset of the previous page
+	for _, shade := range shades {
+		img := image.NewGray(image.Rect(0, 0, 4, 3))
+		for i := range img.Pix {
+			img.Pix[i] = shade
+		}
+		var page bytes.Buffer
+		if err := tiff.Encode(&page, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		data := page.Bytes()
+		base := uint32(len(out))
+		ifd := binary.LittleEndian.Uint32(data[4:8])
+		entries := int(binary.LittleEndian.Uint16(data[ifd : ifd+2]))
+		// relocate the offsets of the page behind the pages before it
+		for e := 0; e < entries; e++ {
+			entry := data[int(ifd)+2+e*12:]
+			count := binary.LittleEndian.Uint32(entry[4:8])
+			size := map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8}[binary.LittleEndian.Uint16(entry[2:4])] * count
+			if tag := binary.LittleEndian.Uint16(entry[0:2]); size > 4 || tag == 273 { // a single StripOffsets fits in the entry
+				binary.LittleEndian.PutUint32(entry[8:12], binary.LittleEndian.Uint32(entry[8:12])+base)
+			}
+		}
+		if previous >= 0 {
+			binary.LittleEndian.PutUint32(out[previous:], ifd+base)
+		}
+		out = append(out, data...)
+		previous = int(ifd+base) + 2 + entries*12
+	}
+	return out
+}
+
+func Test_tiffPageOffsets(t *testing.T) {
+	data := testTiff(t, 0, 128, 255)
+	offsets, err := tiffPageOffsets(bytes.NewReader(data))
+	if err != nil || len(offsets) != 3 {
+		t.Fatalf("tiffPageOffsets() = %v, %v, want 3 pages", offsets, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "scan.tif")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var shades []uint8
+	err = decodeScanPages(path, func(img image.Image) error {
+		shades = append(shades, color.GrayModel.Convert(img.At(1, 1)).(color.Gray).Y)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(shades, []uint8{0, 128, 255}) {
+		t.Errorf("decodeScanPages() = %v, %v, want the shades 0, 128 and 255 in order", shades, err)
+	}
+
+	if _, err := tiffPageOffsets(bytes.NewReader([]byte("not a tiff"))); err == nil {
+		t.Errorf("tiffPageOffsets(not a tiff) did not return an error")
+	}
+	if _, err := tiffPageOffsets(bytes.NewReader(data[:offsets[1]+1])); err == nil {
+		t.Errorf("tiffPageOffsets(truncated) did not return an error")
+	}
+	looped := append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(looped[offsets[0]+2+uint32(binary.LittleEndian.Uint16(looped[offsets[0]:]))*12:], offsets[0])
+	if _, err := tiffPageOffsets(bytes.NewReader(looped)); err == nil {
+		t.Errorf("tiffPageOffsets(bytes.NewReader(looped)) did not return an error")
+	}
+}
+
+func Test_scanDocuments(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	var page bytes.Buffer
+	if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	scan_10 := write("scan_10.png", page.Bytes())
+	scan_2 := write("scan_2.png", page.Bytes())
+	single := write("scan_3.tif", testTiff(t, 255))
+	multi := write("bundle.tiff", testTiff(t, 0, 255))
+
+	documents := scanDocuments([]string{scan_10, multi, scan_2, single})
+	want := [][]string{{multi}, {scan_2, single, scan_10}}
+	if !reflect.DeepEqual(documents, want) {
+		t.Errorf("scanDocuments() = %v, want %v", documents, want)
+	}
+}
+
+func Test_naturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"page_2.jpg", "page_10.jpg", true},
+		{"page_10.jpg", "page_2.jpg", false},
+		{"a.jpg", "b.jpg", true},
+		{"page.jpg", "page_1.jpg", true},
+		{"page_01.jpg", "page_1.jpg", false},
+	}
+	for _, tt := range tests {
+		if got := naturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func Test_synthesize_pdf(t *testing.T) {
+	dir := t.TempDir()
+	var images []string
+	for _, name := range []string{"scan_1.png", "scan_2.png"} {
+		var page bytes.Buffer
+		if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 20, 30))); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, page.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, path)
+	}
+	path := filepath.Join(dir, "scan.pdf")
+	for i := 0; i < 2; i++ { // importing again replaces the PDF instead of appending to it
+		if err := synthesize_pdf(images, path); err != nil {
+			t.Fatalf("synthesize_pdf() error = %v", err)
+		}
+	}
+	if response, err := analyze_pdf_path(path); err != nil || response.Infos[0].Pages != 2 {
+		t.Errorf("analyze_pdf_path(synthesized) = %+v, %v, want 2 pages", response, err)
+	}
+}
+
+func Test_process_import_images(t *testing.T) {
+	for _, logger := range []**CustomLogger{&log_error, &log_info, &log_debug} {
+		previous := *logger
+		*logger = NewCustomLogger(io.Discard, "", 0, 1)
+		t.Cleanup(func() { *logger = previous })
+	}
+	defer func(dir string, clam bool, skip bool, total int32) {
+		*flag_s_database_directory, *flag_b_disable_clamav, *flag_b_skip_duplicates = dir, clam, skip
+		a_i_total_documents.Store(total)
+	}(*flag_s_database_directory, *flag_b_disable_clamav, *flag_b_skip_duplicates, a_i_total_documents.Load())
+	*flag_s_database_directory = t.TempDir()
+	*flag_b_disable_clamav = true
+	*flag_b_skip_duplicates = true
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-ch_GeneratePng.Chan():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var page bytes.Buffer
+	if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 20, 30))); err != nil {
+		t.Fatal(err)
+	}
+	scan := filepath.Join(t.TempDir(), "scan_1.png")
+	if err := os.WriteFile(scan, page.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(page.Bytes())
+	cleanup := func(rd ResultData) {
+		sm_resultdatas.Delete(rd.Identifier)
+		sm_documents.Delete(rd.Identifier)
+		sm_page_directories.Delete(rd.Identifier)
+	}
+
+	ctx := context.WithValue(context.Background(), CtxKey("publisher_checksum"), hex.EncodeToString(digest[:]))
+	if err := process_import_images(ctx, "scan_1.png", []string{scan}, "first/scan_1.png", ""); err != nil {
+		t.Fatalf("process_import_images() error = %v", err)
+	}
+	first, err := read_result_data(filepath.Join(*flag_s_database_directory, Sha256("first/scan_1.png"), "record.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cleanup(first) })
+	if first.PublisherChecksum == nil || !first.PublisherChecksum.Verified || first.TotalPages != 1 {
+		t.Errorf("process_import_images() saved %+v, want one page verified against the checksum of its publisher", first)
+	}
+
+	total := a_i_total_documents.Load()
+	if err := process_import_images(context.Background(), "scan_1.png", []string{scan}, "second/scan_1.png", ""); err != nil {
+		t.Fatalf("process_import_images(duplicate) error = %v", err)
+	}
+	second, err := read_result_data(filepath.Join(*flag_s_database_directory, Sha256("second/scan_1.png"), "record.json"))
+	if err != nil || second.DuplicateOf != first.RecordPath || a_i_total_documents.Load() != total {
+		t.Errorf("process_import_images(duplicate) saved %+v, %v, want a duplicate of %v that is not imported", second, err, first.RecordPath)
+	}
+
+	ctx = context.WithValue(context.Background(), CtxKey("publisher_checksum"), "e4d909c290d0fb1ca068ffaddf22cbd0")
+	if err := process_import_images(ctx, "scan_1.png", []string{scan}, "third/scan_1.png", ""); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("process_import_images(mismatch) error = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if _, err := os.Stat(scan); err != nil {
+		t.Errorf("process_import_images(mismatch) removed the scan it was imported from: %v", err)
+	}
+}
@@ -1,15 +1,12 @@
 #!/bin/bash
 
-sudo wget https://github.com/pdfcpu/pdfcpu/releases/download/v0.9.1/pdfcpu_0.9.1_Linux_x86_64.tar.xz
-sudo tar xf pdfcpu_0.9.1_Linux_x86_64.tar.xz
-sudo mv pdfcpu_0.9.1_Linux_x86_64/pdfcpu /usr/local/bin
-sudo rm -f pdfcpu_0.9.1_Linux_x86_64.tar.xz
-sudo rm -rf pdfcpu_0.9.1_Linux_x86_64
 sudo yum install ghostscript
 sudo yum install pdftotext
-sudo yum install ImageMagick
 sudo yum install tesseract
+sudo yum install tesseract-osd
 sudo yum install libjpeg-turbo-devel
+sudo yum install libwebp-tools libavif-tools openjpeg2-tools
+sudo yum install libreoffice-writer
 sudo yum -y install clamav-server clamav-data clamav-update clamav-filesystem clamav clamav-scanner-systemd clamav-devel clamav-lib clamav-server-systemd
 sudo setsebool -P antivirus_can_scan_system 1
 sudo setsebool -P clamd_use_jit 1
@@ -0,0 +1,114 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// extractTerms tokenizes text into lowercase words and adjacent two word key phrases, skipping m_stop_words,
+// numbers and OCR noise shorter than 3 characters. A skipped token between two words breaks the phrase.
+func extractTerms(text string) []string {
+	var (
+		terms    []string
+		previous string
+	)
+	for _, token := range re_token.FindAllString(text, -1) {
+		word := strings.Trim(strings.ToLower(token), `'-`)
+		if len(word) < 3 || m_stop_words[word] || strings.IndexFunc(word, unicode.IsLetter) == -1 {
+			previous = ""
+			continue
+		}
+		terms = append(terms, word)
+		if len(previous) > 0 {
+			terms = append(terms, previous+" "+word)
+		}
+		previous = word
+	}
+	return terms
+}
+
+// termFrequencies counts each term and returns the counts with the total number of terms counted
+func termFrequencies(terms []string) (map[string]int, int) {
+	counts := make(map[string]int)
+	for _, term := range terms {
+		counts[term]++
+	}
+	return counts, len(terms)
+}
+
+// rankKeywords scores every entry in corpus against the document frequencies of the whole corpus using a smoothed
+// TF-IDF and returns the top N keywords for each key of the corpus
+//
+//	tf    = count(term) / len(terms)
+//	idf   = ln((1 + N) / (1 + df(term))) + 1
+//	score = tf * idf
+func rankKeywords(corpus map[string][]string, topN int) map[string][]Keyword {
+	results := make(map[string][]Keyword, len(corpus))
+	if topN <= 0 || len(corpus) == 0 {
+		return results
+	}
+
+	frequencies := make(map[string]map[string]int, len(corpus))
+	totals := make(map[string]int, len(corpus))
+	documentFrequency := make(map[string]int)
+	for key, terms := range corpus {
+		counts, total := termFrequencies(terms)
+		frequencies[key] = counts
+		totals[key] = total
+		for term := range counts {
+			documentFrequency[term]++
+		}
+	}
+
+	n := float64(len(corpus))
+	for key, counts := range frequencies {
+		if totals[key] == 0 {
+			continue
+		}
+		keywords := make([]Keyword, 0, len(counts))
+		for term, count := range counts {
+			tf := float64(count) / float64(totals[key])
+			idf := math.Log((1+n)/(1+float64(documentFrequency[term]))) + 1
+			keywords = append(keywords, Keyword{Term: term, Score: math.Round(tf*idf*1e6) / 1e6})
+		}
+		sort.Slice(keywords, func(i, j int) bool {
+			if keywords[i].Score == keywords[j].Score {
+				return keywords[i].Term < keywords[j].Term
+			}
+			return keywords[i].Score > keywords[j].Score
+		})
+		if len(keywords) > topN {
+			keywords = keywords[:topN]
+		}
+		results[key] = keywords
+	}
+	return results
+}
+
+// keywordsToString flattens keywords into a comma separated list for the map[string]string metadata
+func keywordsToString(keywords []Keyword) string {
+	terms := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		terms = append(terms, keyword.Term)
+	}
+	return strings.Join(terms, ", ")
+}
@@ -0,0 +1,115 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_extractTerms(t *testing.T) {
+	stop_words := m_stop_words
+	m_stop_words = map[string]bool{"the": true, "of": true}
+	t.Cleanup(func() { m_stop_words = stop_words })
+	testCases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "Test Case 1",
+			input:    "The Warren Commission",
+			expected: []string{"warren", "commission", "warren commission"},
+		},
+		{
+			name:     "Test Case 2",
+			input:    "Office of Naval Intelligence 1963 ab",
+			expected: []string{"office", "naval", "intelligence", "naval intelligence"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := extractTerms(tc.input)
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func Test_rankKeywords(t *testing.T) {
+	corpus := map[string][]string{
+		"A": {"oswald", "oswald", "memo", "cia"},
+		"B": {"memo", "cia", "fbi"},
+		"C": {"memo", "fbi"},
+	}
+	result := rankKeywords(corpus, 2)
+	if len(result["A"]) != 2 || result["A"][0].Term != "oswald" {
+		t.Errorf("Expected oswald to rank first for A, but got %v", result["A"])
+	}
+	if len(result["C"]) != 2 || result["C"][0].Term != "fbi" {
+		t.Errorf("Expected fbi to rank first for C, but got %v", result["C"])
+	}
+	if len(rankKeywords(corpus, 0)) != 0 {
+		t.Errorf("Expected no keywords when topN is 0")
+	}
+}
+
+func Test_collection_corpus(t *testing.T) {
+	debug := log_debug
+	log_debug = NewCustomLogger(io.Discard, "", 0, 1)
+	stop_words := m_stop_words
+	m_stop_words = map[string]bool{}
+	t.Cleanup(func() { log_debug, m_stop_words = debug, stop_words })
+
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	scanned := ResultData{Identifier: "scanned", ExtractedTextPath: write("scanned.txt", "Warren Commission")}
+	born_digital := ResultData{Identifier: "digital", ExtractedTextPath: write("digital.txt", "Naval Intelligence")}
+	for _, rd := range []ResultData{scanned, born_digital} {
+		sm_resultdatas.Store(rd.Identifier, rd)
+		t.Cleanup(func() { sm_resultdatas.Delete(rd.Identifier) })
+	}
+	pages := map[string][]PendingPage{
+		"scanned": {{Identifier: "page1", RecordIdentifier: "scanned", OCRTextPath: write("ocr1.txt", "Warren Commission")}},
+		"digital": {{Identifier: "page2", RecordIdentifier: "digital", OCRTextPath: filepath.Join(dir, "missing.txt")}},
+	}
+
+	page_corpus, document_corpus := collection_corpus(context.Background(), pages)
+	want := []string{"warren", "commission", "warren commission"}
+	if !reflect.DeepEqual(page_corpus["page1"], want) {
+		t.Errorf("collection_corpus() page1 = %v, want %v", page_corpus["page1"], want)
+	}
+	if !reflect.DeepEqual(document_corpus["scanned"], want) {
+		t.Errorf("collection_corpus() scanned = %v, want the OCR terms counted once %v", document_corpus["scanned"], want)
+	}
+	if want := []string{"naval", "intelligence", "naval intelligence"}; !reflect.DeepEqual(document_corpus["digital"], want) {
+		t.Errorf("collection_corpus() digital = %v, want the extracted terms %v", document_corpus["digital"], want)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isOfficeDocument returns true for the document formats that are converted to PDF before they are imported
+func isOfficeDocument(path string) bool {
+	return m_office_extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// convert_to_pdf uses LibreOffice to convert the document at source into <dir>/<filename>.pdf; every conversion gets
+// its own LibreOffice profile in dir so conversions can run concurrently
+func convert_to_pdf(source, dir string) (string, error) {
+	soffice := m_optional_binaries["soffice"]
+	if len(soffice) == 0 {
+		return "", fmt.Errorf("soffice is not installed to convert %v to pdf", source)
+	}
+	args := []string{
+		"--headless", "--norestore", "--nolockcheck",
+		"-env:UserInstallation=file://" + filepath.ToSlash(filepath.Join(dir, "profile")),
+	}
+	if strings.EqualFold(filepath.Ext(source), ".txt") {
+		args = append(args, "--infilter=Text (encoded):UTF8,LF,,") // plain text is not always recognized by its contents
+	}
+	args = append(args, "--convert-to", "pdf", "--outdir", dir, source)
+
+	converted := filepath.Join(dir, strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))+".pdf")
+	sem_soffice.Acquire()
+	err := runEncoder(soffice, converted, args...)
+	sem_soffice.Release()
+	if err != nil {
+		return "", err
+	}
+	if ok, err := fileHasData(converted); !ok || err != nil {
+		return "", fmt.Errorf("soffice did not convert %v to %v (err %v)", source, converted, err)
+	}
+
+	// the extension of the source stays in the name so memo.docx and memo.pdf are imported as different records
+	pdf := filepath.Join(dir, filepath.Base(source)+".pdf")
+	if err := os.Rename(converted, pdf); err != nil {
+		return "", err
+	}
+	return pdf, nil
+}
+
+// process_import_office converts the office or text document at path to a PDF that is imported with
+// process_import_pdf, keeping the original document in the sources directory of the record
+func process_import_office(ctx context.Context, path string, metadata_json string) error {
+	workDir, err := os.MkdirTemp("", "apario-convert-")
+	if err != nil {
+		return log_error.TraceReturn(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// clamscan --remove acts on a copy so the original document is never touched
+	source := filepath.Join(workDir, filepath.Base(path))
+	if err := copy_file(path, source); err != nil {
+		return log_error.TraceReturnf("failed to copy %v into %v due to err %v", path, workDir, err)
+	}
+	if !*flag_b_disable_clamav {
+		output, action_taken, clamav_scan_err := scan_path_with_clam_av(source)
+		if clamav_scan_err != nil {
+			return log_debug.TraceReturnf("while scanning %v clamav scan returned an err: %v", source, clamav_scan_err)
+		}
+		if action_taken {
+			return log_debug.TraceReturnf("action taken against %v with clamav: %v", source, output)
+		}
+	}
+
+	ctx, err = check_source_checksum(ctx, source, filepath.Join(workDir, filepath.Base(source)+".pdf"))
+	if err != nil {
+		return err
+	}
+
+	pdf, err := convert_to_pdf(source, workDir)
+	if err != nil {
+		return log_error.TraceReturnf("failed to convert %v to pdf due to err %v", path, err)
+	}
+	log_info.Printf("converted %v to %v", path, pdf)
+	return process_import_pdf(context.WithValue(ctx, CtxKey("sources"), []string{source}), pdf, metadata_json)
+}
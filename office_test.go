@@ -0,0 +1,69 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func Test_keep_sources(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "memo.docx")
+	if err := os.WriteFile(source, []byte("memo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := keep_sources([]string{source}, filepath.Join(dir, "record", "sources"))
+	if err != nil || len(kept) != 1 || kept[0] != filepath.Join(dir, "record", "sources", "memo.docx") {
+		t.Fatalf("keep_sources() = %v, %v", kept, err)
+	}
+	if data, err := os.ReadFile(kept[0]); err != nil || string(data) != "memo" {
+		t.Errorf("keep_sources() copied %q, %v, want memo", data, err)
+	}
+	if kept, err := keep_sources(nil, filepath.Join(dir, "none")); err != nil || kept != nil || IsDir(filepath.Join(dir, "none")) {
+		t.Errorf("keep_sources(nil) = %v, %v, want nothing", kept, err)
+	}
+}
+
+func Test_convert_to_pdf(t *testing.T) {
+	if _, err := convert_to_pdf(filepath.Join(t.TempDir(), "memo.docx"), t.TempDir()); err == nil {
+		t.Errorf("convert_to_pdf() without soffice did not return an error")
+	}
+
+	soffice, err := exec.LookPath("soffice")
+	if err != nil {
+		t.Skip("soffice is not installed")
+	}
+	m_optional_binaries["soffice"] = soffice
+	defer delete(m_optional_binaries, "soffice")
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "memo.txt")
+	if err := os.WriteFile(source, []byte("MEMORANDUM FOR THE RECORD\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := convert_to_pdf(source, dir)
+	if err != nil || pdf != filepath.Join(dir, "memo.txt.pdf") {
+		t.Fatalf("convert_to_pdf() = %v, %v", pdf, err)
+	}
+	if response, err := analyze_pdf_path(pdf); err != nil || response.Infos[0].Pages != 1 {
+		t.Errorf("analyze_pdf_path(converted) = %+v, %v, want 1 page", response, err)
+	}
+}
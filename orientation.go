@@ -0,0 +1,249 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	c_deskew_step  = 0.25 // degrees between each skew angle that is scored
+	c_deskew_width = 800  // width of the thumbnail that the projection profile is computed from
+)
+
+// detectOrientation runs tesseract orientation and script detection against path and returns the clockwise
+// rotation (0, 90, 180 or 270) that makes the text upright along with tesseract's confidence
+//
+//	tesseract <path> - --psm 0
+func detectOrientation(path string) (int, float64, error) {
+	cmd := exec.Command(m_required_binaries["tesseract"], path, "-", "--psm", "0")
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	sem_tesseract.Acquire()
+	err := cmd.Run()
+	sem_tesseract.Release()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to execute `tesseract %v - --psm 0` due to error: %v\n\tSTDERR = %v", path, err, stderr.String())
+	}
+
+	rotation, confidence, err := parseOSD(&stdout)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%v: %v", path, err)
+	}
+	return rotation, confidence, nil
+}
+
+// parseOSD reads the Rotate and Orientation confidence lines of the `tesseract --psm 0` output and returns the
+// clockwise rotation (0, 90, 180 or 270) along with the confidence
+func parseOSD(output io.Reader) (int, float64, error) {
+	var (
+		rotation   int
+		confidence float64
+		found      bool
+		err        error
+	)
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Rotate":
+			rotation, err = strconv.Atoi(value)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to parse the rotation %q from tesseract: %v", value, err)
+			}
+			found = true
+		case "Orientation confidence":
+			confidence, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("tesseract did not report a rotation")
+	}
+	return ((rotation % 360) + 360) % 360, confidence, nil
+}
+
+// tesseractHasLanguage returns true when `tesseract --list-langs` lists the traineddata of language, such as the
+// osd that --orientation requires
+func tesseractHasLanguage(language string) (bool, error) {
+	output, err := exec.Command(m_required_binaries["tesseract"], "--list-langs").CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("failed to execute `tesseract --list-langs` due to error: %v\n\tOUTPUT = %v", err, string(output))
+	}
+	return hasTesseractLanguage(bytes.NewReader(output), language), nil
+}
+
+// hasTesseractLanguage returns true when the `tesseract --list-langs` output lists language
+func hasTesseractLanguage(output io.Reader, language string) bool {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == language {
+			return true
+		}
+	}
+	return false
+}
+
+// detectSkew scores every angle within --max-skew degrees by the sharpness of the horizontal projection profile of
+// the ink pixels; text lines are sharpest when they are level. The returned angle is counter-clockwise as used by
+// imaging.Rotate.
+func detectSkew(img image.Image, maxSkew float64) float64 {
+	if maxSkew <= 0 {
+		return 0
+	}
+	small := imaging.Grayscale(imaging.Resize(img, c_deskew_width, 0, imaging.Box))
+	bounds := small.Bounds()
+	cx, cy := float64(bounds.Dx())/2, float64(bounds.Dy())/2
+
+	type point struct{ x, y float64 }
+	var ink []point
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			if small.Pix[y*small.Stride+x*4] < c_ink_luminance {
+				ink = append(ink, point{float64(x) - cx, float64(y) - cy})
+			}
+		}
+	}
+	if len(ink) == 0 {
+		return 0
+	}
+
+	height := int(math.Hypot(float64(bounds.Dx()), float64(bounds.Dy()))) + 2
+	best, bestScore := 0.0, -1.0
+	for angle := -maxSkew; angle <= maxSkew+1e-9; angle += c_deskew_step {
+		radians := angle * math.Pi / 180
+		sin, cos := math.Sin(radians), math.Cos(radians)
+		profile := make([]float64, height)
+		for _, p := range ink {
+			row := int(-p.x*sin+p.y*cos) + height/2
+			if row >= 0 && row < height {
+				profile[row]++
+			}
+		}
+		var score float64
+		for i := 1; i < height; i++ {
+			delta := profile[i] - profile[i-1]
+			score += delta * delta
+		}
+		if score > bestScore || (score == bestScore && math.Abs(angle) < math.Abs(best)) {
+			best, bestScore = angle, score
+		}
+	}
+	return math.Round(best*100) / 100
+}
+
+// correctPageOrientation rotates pp.PNG.Light[c_rendition_original] upright with tesseract OSD (--orientation) and levels the
+// text lines with a projection profile (--deskew), then records the applied correction in pp.Orientation
+func correctPageOrientation(pp PendingPage) PendingPage {
+	if !*flag_b_orientation && !*flag_b_deskew {
+		return pp
+	}
+	pp.Orientation = PageOrientation{}
+
+	if *flag_b_orientation {
+		rotation, confidence, err := detectOrientation(pp.PNG.Light[c_rendition_original])
+		if err != nil {
+			log_error.Tracef("failed to detect the orientation of %v due to error %v", pp.PNG.Light[c_rendition_original], err)
+		} else if confidence >= *flag_f_orientation_confidence {
+			pp.Orientation.Rotation = rotation
+			pp.Orientation.Confidence = confidence
+			pp.Orientation.Method = "osd"
+		}
+	}
+
+	file, err := os.Open(pp.PNG.Light[c_rendition_original])
+	if err != nil {
+		log_error.Tracef("failed to open %v to correct its orientation due to error %v", pp.PNG.Light[c_rendition_original], err)
+		return pp
+	}
+	img, err := imaging.Decode(file)
+	_ = file.Close()
+	if err != nil {
+		log_error.Tracef("failed to decode %v to correct its orientation due to error %v", pp.PNG.Light[c_rendition_original], err)
+		return pp
+	}
+
+	// imaging rotates counter-clockwise and tesseract reports the clockwise correction
+	corrected := img
+	switch pp.Orientation.Rotation {
+	case 90:
+		corrected = imaging.Rotate270(img)
+	case 180:
+		corrected = imaging.Rotate180(img)
+	case 270:
+		corrected = imaging.Rotate90(img)
+	}
+
+	if *flag_b_deskew {
+		skew := detectSkew(corrected, *flag_f_max_skew)
+		if math.Abs(skew) >= c_deskew_step {
+			bounds := corrected.Bounds()
+			corrected = imaging.CropCenter(imaging.Rotate(corrected, skew, color.White), bounds.Dx(), bounds.Dy())
+			pp.Orientation.Skew = skew
+			if len(pp.Orientation.Method) > 0 {
+				pp.Orientation.Method += "+projection"
+			} else {
+				pp.Orientation.Method = "projection"
+			}
+		}
+	}
+
+	if pp.Orientation.Rotation == 0 && pp.Orientation.Skew == 0 {
+		return pp
+	}
+
+	temporary := pp.PNG.Light[c_rendition_original] + ".tmp"
+	output, err := os.Create(temporary)
+	if err != nil {
+		log_error.Tracef("failed to create %v due to error %v", temporary, err)
+		return pp
+	}
+	err = png.Encode(output, corrected)
+	close_err := output.Close()
+	if err != nil || close_err != nil {
+		log_error.Tracef("failed to encode the corrected %v due to error %v %v", temporary, err, close_err)
+		_ = os.Remove(temporary)
+		return pp
+	}
+	err = os.Rename(temporary, pp.PNG.Light[c_rendition_original])
+	if err != nil {
+		log_error.Tracef("failed to replace %v with the corrected image due to error %v", pp.PNG.Light[c_rendition_original], err)
+		_ = os.Remove(temporary)
+		return pp
+	}
+	log_info.Printf("rotated page %d of %v by %d degrees and deskewed it by %.2f degrees", pp.PageNumber, pp.RecordIdentifier, pp.Orientation.Rotation, pp.Orientation.Skew)
+	return pp
+}
@@ -0,0 +1,86 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func Test_parseOSD(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		rotation   int
+		confidence float64
+		wantErr    bool
+	}{
+		{"upside down", "Page number: 0\nOrientation in degrees: 180\nRotate: 180\nOrientation confidence: 14.87\nScript: Latin\nScript confidence: 2.54\n", 180, 14.87, false},
+		{"sideways", "Page number: 0\nOrientation in degrees: 270\nRotate: 90\nOrientation confidence: 21.48\nScript: Latin\nScript confidence: 3.33\n", 90, 21.48, false},
+		{"negative", "Rotate: -90\nOrientation confidence: 3.1\n", 270, 3.1, false},
+		{"too few characters", "Too few characters. Skipping this page\n", 0, 0, true},
+		{"malformed", "Rotate: ninety\n", 0, 0, true},
+	}
+	for _, tt := range tests {
+		rotation, confidence, err := parseOSD(strings.NewReader(tt.output))
+		if (err != nil) != tt.wantErr || rotation != tt.rotation || confidence != tt.confidence {
+			t.Errorf("parseOSD(%v) = %v, %v, %v, want %v, %v, error %v", tt.name, rotation, confidence, err, tt.rotation, tt.confidence, tt.wantErr)
+		}
+	}
+}
+
+func Test_hasTesseractLanguage(t *testing.T) {
+	output := "List of available languages in \"/usr/share/tesseract-ocr/5/tessdata/\" (3):\neng\nosd\nrus\n"
+	if !hasTesseractLanguage(strings.NewReader(output), "osd") {
+		t.Errorf("hasTesseractLanguage(osd) = false")
+	}
+	if hasTesseractLanguage(strings.NewReader("List of available languages (1):\neng\n"), "osd") {
+		t.Errorf("hasTesseractLanguage(osd) = true without the osd traineddata")
+	}
+}
+
+func Test_detectSkew(t *testing.T) {
+	page := imaging.New(800, 1000, color.White)
+	for line := 0; line < 30; line++ {
+		for y := 100 + line*26; y < 110+line*26; y++ {
+			for x := 100; x < 700; x++ {
+				page.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	if skew := detectSkew(page, 5); skew != 0 {
+		t.Errorf("detectSkew(level) = %v, want 0", skew)
+	}
+	for _, angle := range []float64{3, -2, 1.5} {
+		rotated := imaging.Rotate(page, angle, color.White)
+		if skew := detectSkew(rotated, 5); math.Abs(skew+angle) > c_deskew_step {
+			t.Errorf("detectSkew(rotated %v degrees) = %v, want %v", angle, skew, -angle)
+		}
+	}
+	if skew := detectSkew(imaging.Rotate(page, 3, color.White), 0); skew != 0 {
+		t.Errorf("detectSkew() with a max skew of 0 = %v, want 0", skew)
+	}
+	if skew := detectSkew(imaging.New(100, 100, color.White), 5); skew != 0 {
+		t.Errorf("detectSkew(blank) = %v, want 0", skew)
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// ErrPDFPasswordRequired is returned by unlock_pdf when an encrypted PDF cannot be opened with the password provided
+var ErrPDFPasswordRequired = errors.New("pdf is encrypted and no valid password was provided")
+
+func init() {
+	// pdfcpu would otherwise create (and exit the writer on problems with) a config.yml in the user config directory
+	model.ConfigPath = "disable"
+}
+
+// PDFError is returned by every call into the pdfcpu library with the operation and the file that failed
+type PDFError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *PDFError) Error() string {
+	return fmt.Sprintf("pdfcpu %v %v: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *PDFError) Unwrap() error {
+	return e.Err
+}
+
+// pdfcpu_configuration returns the relaxed pdfcpu configuration that the `pdfcpu` binary defaults to
+func pdfcpu_configuration() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	return conf
+}
+
+// validate_pdf uses pdfcpu to validate a PDF file path provided
+func validate_pdf(path string) error {
+	sem_pdfcpu.Acquire()
+	defer sem_pdfcpu.Release()
+	err := api.ValidateFile(path, pdfcpu_configuration())
+	if err != nil {
+		return &PDFError{Op: "validate", Path: path, Err: err}
+	}
+	return nil
+}
+
+// optimize_pdf uses pdfcpu to optimize a PDF file path provided in place
+func optimize_pdf(path string) error {
+	sem_pdfcpu.Acquire()
+	defer sem_pdfcpu.Release()
+	err := api.OptimizeFile(path, "", pdfcpu_configuration())
+	if err != nil {
+		return &PDFError{Op: "optimize", Path: path, Err: err}
+	}
+	return nil
+}
+
+// extract_pdf_pages uses pdfcpu to write every page of the PDF file path provided into pagesDir as
+// <basename>_page_<n>.pdf
+func extract_pdf_pages(path, pagesDir string) error {
+	sem_pdfcpu.Acquire()
+	defer sem_pdfcpu.Release()
+	err := api.ExtractPagesFile(path, pagesDir, nil, pdfcpu_configuration())
+	if err != nil {
+		return &PDFError{Op: "extract", Path: path, Err: err}
+	}
+	return nil
+}
+
+// analyze_pdf_path uses pdfcpu to determine properties about a PDF file; the response has the same shape as
+// `pdfcpu info -json <path>` so existing record.json files stay comparable
+func analyze_pdf_path(path string) (PDFCPUInfoResponse, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return PDFCPUInfoResponse{}, &PDFError{Op: "info", Path: path, Err: err}
+	}
+	defer file.Close()
+
+	sem_pdfcpu.Acquire()
+	info, err := api.PDFInfo(file, filepath.Base(path), nil, false, pdfcpu_configuration())
+	sem_pdfcpu.Release()
+	if err != nil {
+		return PDFCPUInfoResponse{}, &PDFError{Op: "info", Path: path, Err: err}
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return PDFCPUInfoResponse{}, &PDFError{Op: "info", Path: path, Err: err}
+	}
+	var pdf_info PDFCPUInfoResponseInfo
+	err = json.Unmarshal(data, &pdf_info)
+	if err != nil {
+		return PDFCPUInfoResponse{}, &PDFError{Op: "info", Path: path, Err: err}
+	}
+	pdf_info.Pages = info.PageCount
+	pdf_info.PageCount = info.PageCount
+	return PDFCPUInfoResponse{
+		Header: map[string]string{"version": "pdfcpu " + model.VersionStr},
+		Infos:  []PDFCPUInfoResponseInfo{pdf_info},
+	}, nil
+}
+
+// pdf_password returns the password of the import row in ctx or --pdf-password
+func pdf_password(ctx context.Context) string {
+	if password, ok := ctx.Value(CtxKey("pdf_password")).(string); ok && len(password) > 0 {
+		return password
+	}
+	return *flag_s_pdf_password
+}
+
+// decrypt_pdf uses pdfcpu to write a decrypted copy of the PDF file path provided to out; the password is tried as
+// both the owner and the user password
+func decrypt_pdf(path, out, password string) error {
+	conf := pdfcpu_configuration()
+	conf.UserPW, conf.OwnerPW = password, password
+	sem_pdfcpu.Acquire()
+	defer sem_pdfcpu.Release()
+	err := api.DecryptFile(path, out, conf)
+	if err != nil {
+		return &PDFError{Op: "decrypt", Path: path, Err: err}
+	}
+	return nil
+}
+
+// unlock_pdf detects whether the PDF file path provided is encrypted and decrypts it with the password of the import
+// into the working copy decrypted_<basename> next to it; the path that the pipeline must render is returned, which is
+// path itself when the PDF is not encrypted. ErrPDFPasswordRequired is returned when the PDF needs a password that
+// was not provided or is wrong
+func unlock_pdf(ctx context.Context, path string) (working_path string, encrypted bool, err error) {
+	response, analyze_err := analyze_pdf_path(path)
+	if analyze_err == nil && (len(response.Infos) == 0 || !response.Infos[0].Encrypted) {
+		return path, false, nil
+	}
+	if analyze_err != nil && !errors.Is(analyze_err, pdfcpu.ErrWrongPassword) {
+		return path, false, nil // corrupted PDFs are left to repair_pdf
+	}
+
+	working_path = filepath.Join(filepath.Dir(path), "decrypted_"+filepath.Base(path))
+	decrypt_err := decrypt_pdf(path, working_path, pdf_password(ctx))
+	if errors.Is(decrypt_err, pdfcpu.ErrWrongPassword) {
+		return path, true, fmt.Errorf("%w: %v", ErrPDFPasswordRequired, path)
+	}
+	if decrypt_err != nil {
+		return path, true, decrypt_err
+	}
+	return working_path, true, nil
+}
+
+// record_encrypted_pdf writes rd into record.json with the terminal status c_status_encrypted_no_password so the
+// document can be re-imported once its password is known; it is never sent into ch_ImportedRow
+func record_encrypted_pdf(rd ResultData) error {
+	file, err := os.Open(rd.PDFPath)
+	if err != nil {
+		return err
+	}
+	rd.PDFChecksum = FileSha512(file)
+	_ = file.Close()
+	rd.Status = c_status_encrypted_no_password
+	rd.Encrypted = true
+	rd.Info.Encrypted = true
+	log_info.Printf("skipping %v because it is encrypted and no valid password was provided", rd.PDFPath)
+	return WriteResultDataToJson(rd)
+}
+
+// pdf_table_of_contents uses pdfcpu to read the outline (bookmarks) of the PDF file path provided
+func pdf_table_of_contents(path string) ([]TableOfContents, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &PDFError{Op: "bookmarks", Path: path, Err: err}
+	}
+	defer file.Close()
+
+	sem_pdfcpu.Acquire()
+	bookmarks, err := api.Bookmarks(file, pdfcpu_configuration())
+	sem_pdfcpu.Release()
+	if err != nil {
+		return nil, &PDFError{Op: "bookmarks", Path: path, Err: err}
+	}
+	return table_of_contents(bookmarks), nil
+}
+
+func table_of_contents(bookmarks []pdfcpu.Bookmark) []TableOfContents {
+	var entries []TableOfContents
+	for _, bookmark := range bookmarks {
+		entries = append(entries, TableOfContents{
+			Title:    bookmark.Title,
+			Page:     bookmark.PageFrom,
+			Children: table_of_contents(bookmark.Kids),
+		})
+	}
+	return entries
+}
+
+// pdf_annotations uses pdfcpu to read the annotations of every page of the PDF file path provided by page number
+func pdf_annotations(path string) (map[int][]Annotation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &PDFError{Op: "annotations", Path: path, Err: err}
+	}
+	defer file.Close()
+
+	sem_pdfcpu.Acquire()
+	pages, err := api.Annotations(file, nil, pdfcpu_configuration())
+	sem_pdfcpu.Release()
+	if err != nil {
+		return nil, &PDFError{Op: "annotations", Path: path, Err: err}
+	}
+	annotations := make(map[int][]Annotation)
+	for pgNo, page := range pages {
+		for annotation_type, annots := range page {
+			for _, annot := range annots.Map {
+				name := model.AnnotTypeStrings[annotation_type]
+				if len(annot.CustomTypeString()) > 0 {
+					name = annot.CustomTypeString()
+				}
+				annotations[pgNo] = append(annotations[pgNo], Annotation{
+					Identifier: annot.ID(),
+					Type:       name,
+					Rect:       annot.RectString(),
+					Contents:   unquote_pdf_string(annot.ContentString()),
+				})
+			}
+		}
+		sort.Slice(annotations[pgNo], func(i, j int) bool {
+			a, b := annotations[pgNo][i], annotations[pgNo][j]
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+			return a.Rect < b.Rect
+		})
+	}
+	return annotations, nil
+}
+
+// unquote_pdf_string removes the quotes that pdfcpu keeps around the text strings of annotations it read
+func unquote_pdf_string(value string) string {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+	return value
+}
+
+// extract_pdf_attachments uses pdfcpu to write the embedded files of the PDF file path provided into dir
+func extract_pdf_attachments(path, dir string) ([]Attachment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &PDFError{Op: "attachments", Path: path, Err: err}
+	}
+	defer file.Close()
+
+	sem_pdfcpu.Acquire()
+	embedded, err := api.ExtractAttachmentsRaw(file, dir, nil, pdfcpu_configuration())
+	sem_pdfcpu.Release()
+	if err != nil {
+		return nil, &PDFError{Op: "attachments", Path: path, Err: err}
+	}
+	if len(embedded) == 0 {
+		return nil, nil
+	}
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []Attachment
+	taken := make(map[string]bool)
+	for i, a := range embedded {
+		attachment_path := filepath.Join(dir, attachment_filename(i, a.FileName, taken))
+		destination, err := os.Create(attachment_path)
+		if err != nil {
+			return attachments, err
+		}
+		size, copy_err := io.Copy(destination, a)
+		close_err := destination.Close()
+		if err = errors.Join(copy_err, close_err); err != nil {
+			return attachments, err
+		}
+		attachments = append(attachments, Attachment{
+			FileName:    a.FileName,
+			Description: a.Desc,
+			ModifiedAt:  a.ModTime,
+			Path:        attachment_path,
+			Bytes:       size,
+		})
+	}
+	return attachments, nil
+}
@@ -0,0 +1,225 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// testPDF returns a minimal PDF with the number of blank pages
+func testPDF(pages int) []byte {
+	var objects []string
+	kids := ""
+	for i := 0; i < pages; i++ {
+		kids += fmt.Sprintf("%d 0 R ", 3+i)
+	}
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %d >>", kids, pages))
+	for i := 0; i < pages; i++ {
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+	}
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%v\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+func Test_pdfcpu_library(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "memo.pdf")
+	if err := os.WriteFile(path, testPDF(3), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validate_pdf(path); err != nil {
+		t.Fatalf("validate_pdf() error = %v", err)
+	}
+	response, err := analyze_pdf_path(path)
+	if err != nil {
+		t.Fatalf("analyze_pdf_path() error = %v", err)
+	}
+	if len(response.Infos) != 1 || response.Infos[0].Pages != 3 || response.Infos[0].PageCount != 3 {
+		t.Errorf("analyze_pdf_path() = %+v, want 3 pages", response)
+	}
+	if err := optimize_pdf(path); err != nil {
+		t.Errorf("optimize_pdf() error = %v", err)
+	}
+
+	pagesDir := filepath.Join(dir, "pages")
+	if err := os.MkdirAll(pagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := extract_pdf_pages(path, pagesDir); err != nil {
+		t.Fatalf("extract_pdf_pages() error = %v", err)
+	}
+	for page := 1; page <= 3; page++ {
+		if _, err := os.Stat(filepath.Join(pagesDir, fmt.Sprintf("memo_page_%d.pdf", page))); err != nil {
+			t.Errorf("extract_pdf_pages() did not write page %d: %v", page, err)
+		}
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.pdf")
+	_ = os.WriteFile(corrupt, []byte("not a pdf"), 0644)
+	var pdf_err *PDFError
+	if err := validate_pdf(corrupt); !errors.As(err, &pdf_err) || pdf_err.Op != "validate" {
+		t.Errorf("validate_pdf(corrupt) = %v, want a *PDFError", err)
+	}
+}
+
+func Test_unlock_pdf(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.pdf")
+	if err := os.WriteFile(plain, testPDF(2), 0644); err != nil {
+		t.Fatal(err)
+	}
+	locked := filepath.Join(dir, "locked.pdf")
+	if err := api.EncryptFile(plain, locked, model.NewAESConfiguration("secret", "owner", 256)); err != nil {
+		t.Fatal(err)
+	}
+
+	restricted := filepath.Join(dir, "restricted.pdf")
+	if err := api.EncryptFile(plain, restricted, model.NewAESConfiguration("", "owner", 256)); err != nil {
+		t.Fatal(err)
+	}
+
+	working, encrypted, err := unlock_pdf(context.Background(), plain)
+	if err != nil || encrypted || working != plain {
+		t.Errorf("unlock_pdf(plain) = %v, %v, %v, want %v, false, nil", working, encrypted, err, plain)
+	}
+
+	// only an owner password: anyone can open it, so it is decrypted without a password
+	working, encrypted, err = unlock_pdf(context.Background(), restricted)
+	if err != nil || !encrypted || working != filepath.Join(dir, "decrypted_restricted.pdf") {
+		t.Errorf("unlock_pdf(restricted) = %v, %v, %v", working, encrypted, err)
+	}
+
+	_, encrypted, err = unlock_pdf(context.Background(), locked)
+	if !errors.Is(err, ErrPDFPasswordRequired) || !encrypted {
+		t.Errorf("unlock_pdf(locked) without a password = %v, %v, want ErrPDFPasswordRequired", encrypted, err)
+	}
+	wrong := context.WithValue(context.Background(), CtxKey("pdf_password"), "wrong")
+	if _, _, err = unlock_pdf(wrong, locked); !errors.Is(err, ErrPDFPasswordRequired) {
+		t.Errorf("unlock_pdf(locked) with a wrong password = %v, want ErrPDFPasswordRequired", err)
+	}
+
+	ctx := context.WithValue(context.Background(), CtxKey("pdf_password"), "secret")
+	working, encrypted, err = unlock_pdf(ctx, locked)
+	if err != nil || !encrypted {
+		t.Fatalf("unlock_pdf(locked) with the password = %v, %v, want true, nil", encrypted, err)
+	}
+	if working != filepath.Join(dir, "decrypted_locked.pdf") {
+		t.Errorf("unlock_pdf(locked) working copy = %v", working)
+	}
+	response, err := analyze_pdf_path(working)
+	if err != nil || response.Infos[0].Encrypted || response.Infos[0].Pages != 2 {
+		t.Errorf("analyze_pdf_path(decrypted) = %+v, %v, want 2 unencrypted pages", response, err)
+	}
+}
+
+func Test_pdf_contents(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.pdf")
+	if err := os.WriteFile(plain, testPDF(3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	child := filepath.Join(dir, "exhibit.pdf")
+	if err := os.WriteFile(child, testPDF(1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bookmarked := filepath.Join(dir, "bookmarked.pdf")
+	bookmarks := []pdfcpu.Bookmark{
+		{Title: "Summary", PageFrom: 1},
+		{Title: "Findings", PageFrom: 2, Kids: []pdfcpu.Bookmark{{Title: "Exhibits", PageFrom: 3}}},
+	}
+	if err := api.AddBookmarksFile(plain, bookmarked, bookmarks, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	annotated := filepath.Join(dir, "annotated.pdf")
+	note := model.NewTextAnnotation(*types.NewRectangle(10, 10, 60, 60), 0, "see exhibit A", "note-1", "", 0, nil, "", nil, nil, "", "", 0, 0, 0, false, "Comment")
+	if err := api.AddAnnotationsFile(bookmarked, annotated, []string{"2"}, note, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	memo := filepath.Join(dir, "memo.pdf")
+	if err := api.AddAttachmentsFile(annotated, memo, []string{child}, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	toc, err := pdf_table_of_contents(memo)
+	if err != nil {
+		t.Fatalf("pdf_table_of_contents() error = %v", err)
+	}
+	if len(toc) != 2 || toc[0].Title != "Summary" || toc[1].Page != 2 || len(toc[1].Children) != 1 || toc[1].Children[0].Page != 3 {
+		t.Errorf("pdf_table_of_contents() = %+v", toc)
+	}
+	if toc, err := pdf_table_of_contents(plain); err != nil || len(toc) != 0 {
+		t.Errorf("pdf_table_of_contents(plain) = %+v, %v, want none", toc, err)
+	}
+
+	annotations, err := pdf_annotations(memo)
+	if err != nil {
+		t.Fatalf("pdf_annotations() error = %v", err)
+	}
+	if len(annotations[1]) != 0 || len(annotations[2]) != 1 || annotations[2][0].Type != "Text" || annotations[2][0].Contents != "see exhibit A" {
+		t.Errorf("pdf_annotations() = %+v, want one Text annotation on page 2", annotations)
+	}
+
+	attachments, err := extract_pdf_attachments(memo, filepath.Join(dir, "attachments"))
+	if err != nil {
+		t.Fatalf("extract_pdf_attachments() error = %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].FileName != "exhibit.pdf" || attachments[0].Bytes == 0 {
+		t.Fatalf("extract_pdf_attachments() = %+v, want exhibit.pdf", attachments)
+	}
+	if response, err := analyze_pdf_path(attachments[0].Path); err != nil || response.Infos[0].Pages != 1 {
+		t.Errorf("analyze_pdf_path(%v) = %+v, %v, want the 1 page exhibit", attachments[0].Path, response, err)
+	}
+}
+
+func Test_attachment_filename(t *testing.T) {
+	taken := make(map[string]bool)
+	var got []string
+	for i, name := range []string{"exhibit.pdf", "../../exhibit.pdf", "", "/", "..", "scans/memo.tif"} {
+		got = append(got, attachment_filename(i, name, taken))
+	}
+	want := []string{"exhibit.pdf", "2_exhibit.pdf", "attachment_3", "attachment_4", "attachment_5", "memo.tif"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("attachment_filename() = %v, want %v", got, want)
+	}
+}
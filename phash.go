@@ -0,0 +1,106 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// grayMatrix downsamples img to width x height and returns the luminance of each pixel
+func grayMatrix(img image.Image, width, height int) [][]float64 {
+	small := imaging.Grayscale(imaging.Resize(img, width, height, imaging.Box))
+	matrix := make([][]float64, height)
+	for y := 0; y < height; y++ {
+		matrix[y] = make([]float64, width)
+		for x := 0; x < width; x++ {
+			matrix[y][x] = float64(small.Pix[y*small.Stride+x*4])
+		}
+	}
+	return matrix
+}
+
+// differenceHash (dHash) compares each pixel of a 9x8 grayscale thumbnail with its right neighbour
+func differenceHash(img image.Image) uint64 {
+	matrix := grayMatrix(img, 9, 8)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if matrix[y][x] < matrix[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// perceptualHash (pHash) takes the 2D DCT-II of a 32x32 grayscale thumbnail and sets a bit for every one of the
+// 8x8 lowest frequencies that is above their median; scanning noise and JPEG artifacts live in the higher frequencies
+func perceptualHash(img image.Image) uint64 {
+	const size, low = 32, 8
+	matrix := grayMatrix(img, size, size)
+
+	cosines := make([][]float64, low)
+	for u := 0; u < low; u++ {
+		cosines[u] = make([]float64, size)
+		for x := 0; x < size; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+
+	// separable DCT: rows first, then columns, only for the low frequencies
+	rows := make([][]float64, size)
+	for y := 0; y < size; y++ {
+		rows[y] = make([]float64, low)
+		for u := 0; u < low; u++ {
+			var sum float64
+			for x := 0; x < size; x++ {
+				sum += matrix[y][x] * cosines[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	coefficients := make([]float64, 0, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// the DC coefficient is the average brightness and would skew the median
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for _, coefficient := range coefficients {
+		hash <<= 1
+		if coefficient > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
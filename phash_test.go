@@ -0,0 +1,245 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPage returns a white page with a black bar for every line of text at the x offsets and widths of lines
+func testPage(lines [][2]int, noise uint8) *image.Gray {
+	page := image.NewGray(image.Rect(0, 0, 200, 260))
+	seed := uint32(7)
+	for i := range page.Pix {
+		page.Pix[i] = 255
+		if noise > 0 {
+			seed = seed*1664525 + 1013904223
+			page.Pix[i] -= uint8(seed>>24) % noise
+		}
+	}
+	for n, line := range lines {
+		for y := 20 + n*24; y < 32+n*24; y++ {
+			for x := line[0]; x < line[0]+line[1]; x++ {
+				page.SetGray(x, y, color.Gray{Y: 0})
+			}
+		}
+	}
+	return page
+}
+
+func Test_hammingDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0b1011, 0b0001, 2},
+		{0, ^uint64(0), 64},
+		{0xf0f0f0f0f0f0f0f0, 0x0f0f0f0f0f0f0f0f, 64},
+		{1 << 63, 1, 2},
+	}
+	for _, tt := range tests {
+		if got := hammingDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("hammingDistance(%x, %x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func Test_perceptualHash(t *testing.T) {
+	memo := [][2]int{{20, 160}, {20, 150}, {20, 160}, {20, 90}, {20, 160}, {20, 120}, {20, 160}, {20, 60}}
+	form := [][2]int{{100, 80}, {10, 40}, {100, 80}, {10, 40}, {100, 80}, {10, 40}, {100, 80}, {10, 40}}
+
+	original := testPage(memo, 0)
+	scanned := testPage(memo, 12)
+	other := testPage(form, 0)
+
+	tests := []struct {
+		name    string
+		hash    func(image.Image) uint64
+		maxNear int
+		minFar  int
+	}{
+		{"pHash", perceptualHash, 4, 10},
+		{"dHash", differenceHash, 4, 10},
+	}
+	for _, tt := range tests {
+		if a, b := tt.hash(original), tt.hash(original); a != b {
+			t.Errorf("%v is not deterministic: %x != %x", tt.name, a, b)
+		}
+		if near := hammingDistance(tt.hash(original), tt.hash(scanned)); near > tt.maxNear {
+			t.Errorf("%v distance of the noisy scan = %d, want at most %d", tt.name, near, tt.maxNear)
+		}
+		if far := hammingDistance(tt.hash(original), tt.hash(other)); far < tt.minFar {
+			t.Errorf("%v distance of a different page = %d, want at least %d", tt.name, far, tt.minFar)
+		}
+	}
+}
+
+func Test_clusterImageHashes(t *testing.T) {
+	hashes := [][2]uint64{
+		{0x0000000000000000, 0xffff000000000000},
+		{0xffffffff00000000, 0x00000000ffffffff}, // unrelated
+		{0x0000000000000007, 0xffff000000000001}, // 3 and 1 bits from 0
+		{0x000000000000003f, 0xffff000000000000}, // 6 bits from 0 but 3 from 2
+		{0xffffffff00000001, 0x0000000fffffffff}, // 1 bit from 1 by pHash but 4 by dHash
+	}
+	tests := []struct {
+		distance int
+		want     string
+	}{
+		{3, "map[0:[0 2 3] 1:[1] 4:[4]]"},
+		{4, "map[0:[0 2 3] 1:[1 4]]"},
+		{0, "map[0:[0] 1:[1] 2:[2] 3:[3] 4:[4]]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(clusterImageHashes(context.Background(), hashes, tt.distance)); got != tt.want {
+			t.Errorf("clusterImageHashes(distance %d) = %v, want %v", tt.distance, got, tt.want)
+		}
+	}
+}
+
+func Test_share_page_images(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	var representative, identical PendingPage
+	representative.JPEG.Light = Images{c_rendition_original: write("a.original.jpg", "page"), "social": write("a.social.jpg", "stamped")}
+	identical.JPEG.Light = Images{c_rendition_original: write("b.original.jpg", "page"), "social": write("b.social.jpg", "redacted")}
+
+	if shared := share_page_images(representative, identical, false); shared != 1 {
+		t.Errorf("share_page_images() = %d, want only the byte for byte equal image shared", shared)
+	}
+	a, _ := os.Stat(representative.JPEG.Light[c_rendition_original])
+	b, _ := os.Stat(identical.JPEG.Light[c_rendition_original])
+	if !os.SameFile(a, b) {
+		t.Errorf("share_page_images() did not link the equal images")
+	}
+	if data, _ := os.ReadFile(identical.JPEG.Light["social"]); string(data) != "redacted" {
+		t.Errorf("share_page_images() replaced a different image with %q", data)
+	}
+
+	if shared := share_page_images(representative, identical, true); shared != 2 {
+		t.Errorf("share_page_images(lookalike) = %d, want every image shared", shared)
+	}
+	if data, _ := os.ReadFile(identical.JPEG.Light["social"]); string(data) != "stamped" {
+		t.Errorf("share_page_images(lookalike) kept %q, want the image of the representative", data)
+	}
+}
+
+func Test_analyze_collection_page_clusters(t *testing.T) {
+	info := log_info
+	log_info = NewCustomLogger(io.Discard, "", 0, 1)
+	t.Cleanup(func() { log_info = info })
+	defer func(dir string, phash, dedupe_distance int, dedupe bool) {
+		*flag_s_database_directory, *flag_i_phash_distance, *flag_i_dedupe_distance, *flag_b_dedupe_pages = dir, phash, dedupe_distance, dedupe
+	}(*flag_s_database_directory, *flag_i_phash_distance, *flag_i_dedupe_distance, *flag_b_dedupe_pages)
+	*flag_i_phash_distance = 4
+	*flag_b_dedupe_pages = true
+
+	memo := [][2]int{{20, 160}, {20, 150}, {20, 160}, {20, 90}, {20, 160}, {20, 120}, {20, 160}, {20, 60}}
+	scans := []image.Image{testPage(memo, 0), testPage(memo, 12)} // the same memo scanned twice
+
+	// usage returns the bytes on disk of paths, counting linked files once
+	usage := func(paths ...string) (total int64) {
+		var seen []os.FileInfo
+	next:
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range seen {
+				if os.SameFile(s, info) {
+					continue next
+				}
+			}
+			seen = append(seen, info)
+			total += info.Size()
+		}
+		return total
+	}
+
+	tests := []struct {
+		name     string
+		distance int
+		shared   bool
+	}{
+		{"byte for byte only", -1, false},
+		{"within --dedupe-distance", 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*flag_s_database_directory = t.TempDir()
+			*flag_i_dedupe_distance = tt.distance
+
+			pages := make(map[string][]PendingPage)
+			var paths []string
+			for i, scan := range scans {
+				id := fmt.Sprintf("page%d", i)
+				pp := PendingPage{
+					Identifier:       id,
+					RecordIdentifier: fmt.Sprintf("record%d", i),
+					PageNumber:       1,
+					PHash:            formatFingerprint(perceptualHash(scan)),
+					DHash:            formatFingerprint(differenceHash(scan)),
+					ManifestPath:     filepath.Join(*flag_s_database_directory, id+".json"),
+				}
+				pp.JPEG.Light = Images{c_rendition_original: filepath.Join(*flag_s_database_directory, id+".original.jpg")}
+				file, err := os.Create(pp.JPEG.Light[c_rendition_original])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := jpeg.Encode(file, scan, nil); err != nil {
+					t.Fatal(err)
+				}
+				file.Close()
+				paths = append(paths, pp.JPEG.Light[c_rendition_original])
+				pages[pp.RecordIdentifier] = append(pages[pp.RecordIdentifier], pp)
+				t.Cleanup(func() { sm_pages.Delete(id) })
+			}
+
+			before := usage(paths...)
+			analyze_collection_page_clusters(context.Background(), pages)
+			after := usage(paths...)
+
+			scanned := pages["record1"][0]
+			if len(scanned.Cluster) == 0 || scanned.Cluster != pages["record0"][0].Cluster {
+				t.Errorf("analyze_collection_page_clusters() clusters = %q and %q, want the same cluster", pages["record0"][0].Cluster, scanned.Cluster)
+			}
+			if shared := scanned.SharedImagesWith == "page0"; shared != tt.shared {
+				t.Errorf("analyze_collection_page_clusters() SharedImagesWith = %q, want shared %v", scanned.SharedImagesWith, tt.shared)
+			}
+			if saved := after < before; saved != tt.shared {
+				t.Errorf("analyze_collection_page_clusters() used %d bytes before and %d after, want saved %v", before, after, tt.shared)
+			}
+		})
+	}
+}
@@ -21,11 +21,15 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"image"
+	"image/png"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/disintegration/imaging"
 )
 
 func validate_result_data_record(ctx context.Context, record ResultData) (ResultData, error) {
@@ -86,11 +90,37 @@ func extractPlainTextFromPdf(ctx context.Context, record ResultData) {
 	}
 }
 
+// newPendingPage returns page pgNo of record whose single page PDF is pdfPath and whose images are saved in pagesDir
+func newPendingPage(record ResultData, pagesDir, pdfPath string, pgNo int) PendingPage {
+	return PendingPage{
+		Identifier:       NewIdentifier(9),
+		RecordIdentifier: record.Identifier,
+		PageNumber:       pgNo,
+		PagesDir:         pagesDir,
+		PDFPath:          pdfPath,
+		OCRTextPath:      filepath.Join(pagesDir, fmt.Sprintf("ocr.%06d.txt", pgNo)),
+		ManifestPath:     filepath.Join(pagesDir, fmt.Sprintf("page.%06d.json", pgNo)),
+		PNG: PNG{
+			Light: pageImages(pagesDir, c_theme_light, pgNo, c_format_png, ""),
+			Dark:  pageImages(pagesDir, c_theme_dark, pgNo, c_format_png, ""),
+		},
+		JPEG: JPEG{
+			Light: pageImages(pagesDir, c_theme_light, pgNo, c_format_jpg, c_format_jpg),
+			Dark:  pageImages(pagesDir, c_theme_dark, pgNo, c_format_jpg, c_format_jpg),
+		},
+		WEBP: WEBP{
+			Light: pageImages(pagesDir, c_theme_light, pgNo, c_format_webp, c_format_webp),
+			Dark:  pageImages(pagesDir, c_theme_dark, pgNo, c_format_webp, c_format_webp),
+		},
+		AVIF: AVIF{
+			Light: pageImages(pagesDir, c_theme_light, pgNo, c_format_avif, c_format_avif),
+			Dark:  pageImages(pagesDir, c_theme_dark, pgNo, c_format_avif, c_format_avif),
+		},
+	}
+}
+
 func extractPagesFromPdf(ctx context.Context, record ResultData) {
 	log_info.Printf("started extractPagesFromPdf(%v) = %v", record.Identifier, record.PDFPath)
-	/*
-		pdfcpu extract -mode page REPLACE_WITH_FILE_PATH REPLACE_WITH_OUTPUT_DIRECTORY
-	*/
 	pagesDir := filepath.Join(record.DataDir, "pages")
 	sm_page_directories.Store(record.Identifier, pagesDir)
 	_, pagesDirExistsErr := os.Stat(pagesDir)
@@ -110,20 +140,13 @@ RETRY:
 			log_error.Tracef("failed to create directory %v due to error %v", pagesDir, pagesDirErr)
 			return
 		}
-		cmd_extract_pages_in_pdf := exec.Command(m_required_binaries["pdfcpu"], "extract", "-mode", "page", record.PDFPath, pagesDir)
-		var cmd_extract_pages_in_pdf_stdout bytes.Buffer
-		var cmd_extract_pages_in_pdf_stderr bytes.Buffer
-		cmd_extract_pages_in_pdf.Stdout = &cmd_extract_pages_in_pdf_stdout
-		cmd_extract_pages_in_pdf.Stderr = &cmd_extract_pages_in_pdf_stderr
-		sem_pdfcpu.Acquire()
-		cmd_extract_pages_in_pdf_err := cmd_extract_pages_in_pdf.Run()
-		sem_pdfcpu.Release()
-		if cmd_extract_pages_in_pdf_err != nil {
-			log_error.Tracef("Failed to execute command `pdfcpu extract -mode page %v %v` due to error: %s\n", record.PDFPath, pagesDir, cmd_extract_pages_in_pdf_err)
+		extract_err := extract_pdf_pages(record.PDFPath, pagesDir)
+		if extract_err != nil {
+			log_error.Tracef("failed to extract the pages of %v into %v due to error: %v", record.PDFPath, pagesDir, extract_err)
 			return
 		}
 	} else {
-		log_info.Printf("not performing `pdfcpu extrace -mode page %v %v` because the directory %v already has PDFs inside it", record.PDFPath, pagesDir, pagesDir)
+		log_info.Printf("not performing extract_pdf_pages(%v, %v) because the directory %v already has PDFs inside it", record.PDFPath, pagesDir, pagesDir)
 		check := len(pagesDir) == len(pagesDir)
 
 		if check {
@@ -131,6 +154,11 @@ RETRY:
 		}
 	}
 
+	annotations, annotations_err := pdf_annotations(record.PDFPath)
+	if annotations_err != nil {
+		log_error.Tracef("failed to read the annotations of %v due to error: %v", record.PDFPath, annotations_err)
+	}
+
 	pagesDirWalkErr := filepath.Walk(pagesDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			log_error.Tracef("Error accessing a path %q: %v\n", path, err)
@@ -147,54 +175,14 @@ RETRY:
 			if pgNoErr != nil {
 				return fmt.Errorf("failed to extract the pgNo from the PDF filename %v", info.Name())
 			}
-			identifier := NewIdentifier(9)
-			pp := PendingPage{
-				Identifier:       identifier,
-				RecordIdentifier: record.Identifier,
-				PageNumber:       pgNo,
-				PagesDir:         pagesDir,
-				PDFPath:          path,
-				OCRTextPath:      filepath.Join(pagesDir, fmt.Sprintf("ocr.%06d.txt", pgNo)),
-				ManifestPath:     filepath.Join(pagesDir, fmt.Sprintf("page.%06d.json", pgNo)),
-				PNG: PNG{
-					Light: Images{
-						Original: filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.original.png", pgNo)),
-						Large:    filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.large.png", pgNo)),
-						Medium:   filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.medium.png", pgNo)),
-						Small:    filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.small.png", pgNo)),
-						Social:   filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.social.png", pgNo)),
-					},
-					Dark: Images{
-						Original: filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.original.png", pgNo)),
-						Large:    filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.large.png", pgNo)),
-						Medium:   filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.medium.png", pgNo)),
-						Small:    filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.small.png", pgNo)),
-						Social:   filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.social.png", pgNo)),
-					},
-				},
-				JPEG: JPEG{
-					Light: Images{
-						Original: filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.original.jpg", pgNo)),
-						Large:    filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.large.jpg", pgNo)),
-						Medium:   filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.medium.jpg", pgNo)),
-						Small:    filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.small.jpg", pgNo)),
-						Social:   filepath.Join(pagesDir, fmt.Sprintf("page.light.%06d.social.jpg", pgNo)),
-					},
-					Dark: Images{
-						Original: filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.original.jpg", pgNo)),
-						Large:    filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.large.jpg", pgNo)),
-						Medium:   filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.medium.jpg", pgNo)),
-						Small:    filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.small.jpg", pgNo)),
-						Social:   filepath.Join(pagesDir, fmt.Sprintf("page.dark.%06d.social.jpg", pgNo)),
-					},
-				},
-			}
+			pp := newPendingPage(record, pagesDir, path, pgNo)
+			pp.Annotations = annotations[pgNo]
 			sm_pages.Store(pp.Identifier, pp)
 			err := WritePendingPageToJson(pp)
 			if err != nil {
 				return err
 			}
-			log_info.Printf("sending page %d (ID %v) from record %v URL %v into the ch_GeneratingPng", pgNo, identifier, record.Identifier, record.URL)
+			log_info.Printf("sending page %d (ID %v) from record %v URL %v into the ch_GeneratingPng", pgNo, pp.Identifier, record.Identifier, record.URL)
 			if ch_GeneratePng.CanWrite() {
 				err := ch_GeneratePng.Write(pp)
 				if err != nil {
@@ -221,11 +209,11 @@ func convertPageToPng(ctx context.Context, pp PendingPage) {
 		pdf_to_png: "pdftoppm REPLACE_WITH_PNG_OPTS REPLACE_WITH_FILE_PATH REPLACE_WITH_PNG_PATH",
 	*/
 RECHECK:
-	_, loErr := os.Stat(pp.PNG.Light.Original)
+	_, loErr := os.Stat(pp.PNG.Light[c_rendition_original])
 	if os.IsNotExist(loErr) {
-		originalFilename := strings.ReplaceAll(pp.PNG.Light.Original, `.png`, ``)
+		originalFilename := strings.ReplaceAll(pp.PNG.Light[c_rendition_original], `.png`, ``)
 		cmd := exec.Command(m_required_binaries["pdftoppm"],
-			`-r`, `369`, `-png`, `-freetype`, `yes`, `-aa`, `yes`, `-aaVector`, `yes`, `-thinlinemode`, `solid`,
+			`-r`, strconv.Itoa(*flag_i_render_dpi), `-png`, `-freetype`, `yes`, `-aa`, `yes`, `-aaVector`, `yes`, `-thinlinemode`, `solid`,
 			pp.PDFPath, originalFilename)
 		var cmd_stdout bytes.Buffer
 		var cmd_stderr bytes.Buffer
@@ -235,7 +223,7 @@ RECHECK:
 		cmd_err := cmd.Run()
 		sem_pdftoppm.Release()
 		if cmd_err != nil {
-			log_error.Tracef("failed to convert page %v to png %v due to error: %s\n", filepath.Base(pp.PDFPath), pp.PNG.Light.Original, cmd_err)
+			log_error.Tracef("failed to convert page %v to png %v due to error: %s\n", filepath.Base(pp.PDFPath), pp.PNG.Light[c_rendition_original], cmd_err)
 			return
 		}
 
@@ -245,15 +233,15 @@ RECHECK:
 			return
 		}
 	} else {
-		originalFile, fileErr := os.Open(pp.PNG.Light.Original)
+		originalFile, fileErr := os.Open(pp.PNG.Light[c_rendition_original])
 		if fileErr != nil {
 			if err1 := validatePNGFile(originalFile); err1 != nil {
-				if err2 := os.Remove(pp.PNG.Light.Original); err2 != nil {
+				if err2 := os.Remove(pp.PNG.Light[c_rendition_original]); err2 != nil {
 					goto RECHECK
 				} else {
-					msg := "convertPagePng() pp.PNG.Light.Original exists and has thrown 2 errors:\n" +
+					msg := "convertPagePng() pp.PNG.Light[c_rendition_original] exists and has thrown 2 errors:\n" +
 						"err1 [validatePNGFile(originalFile): %+v\n" +
-						"err2 [os.Remove(pp.PNG.Light.Original]: %+v\n"
+						"err2 [os.Remove(pp.PNG.Light[c_rendition_original]]: %+v\n"
 					log_error.Panicf(msg, err1, err2)
 				}
 			}
@@ -261,6 +249,12 @@ RECHECK:
 		}
 	}
 
+	pp = detectBlankPage(pp)
+	if !pp.Blank {
+		pp = correctPageOrientation(pp)
+	}
+	pp_save(pp)
+
 	log_info.Printf("completed convertPageToPng now sending %v (%v.%v) -> ch_GenerateLight ", pp.PDFPath, pp.RecordIdentifier, pp.Identifier)
 	if ch_GenerateLight.CanWrite() {
 		err := ch_GenerateLight.Write(pp)
@@ -284,43 +278,34 @@ func generateLightThumbnails(ctx context.Context, pp PendingPage) {
 		}
 	}()
 	log_info.Printf("started generateLightThumbnails(%v.%v) = %v", pp.RecordIdentifier, pp.Identifier, pp.PDFPath)
+	if skipBlankPage(pp, c_blank_step_thumbnails) {
+		log_info.Printf("skipping generateLightThumbnails(%v.%v) because the page is blank", pp.RecordIdentifier, pp.Identifier)
+		return
+	}
 
-	original, err := os.Open(pp.PNG.Light.Original)
+	original, err := os.Open(pp.PNG.Light[c_rendition_original])
 	if err != nil {
-		log_error.Tracef("failed to open pp.OriginalPath(%v) due to error %v", pp.PNG.Light.Original, err)
+		log_error.Tracef("failed to open pp.OriginalPath(%v) due to error %v", pp.PNG.Light[c_rendition_original], err)
 		return
 	}
-
-	// create the large thumbnail from the JPG
-	_, llgErr := os.Stat(pp.PNG.Light.Large)
-	if os.IsNotExist(llgErr) {
-		lgResizeErr := resizePng(original, 999, pp.PNG.Light.Large)
-		if lgResizeErr != nil {
-			log_error.Tracef("failed to resize jpg %v due to error %v", pp.PNG.Light.Large, lgResizeErr)
-			return
-		}
+	img, decodeErr := imaging.Decode(original)
+	_ = original.Close()
+	if decodeErr != nil {
+		log_error.Tracef("failed to decode %v due to error %v", pp.PNG.Light[c_rendition_original], decodeErr)
+		return
 	}
 
-	// create the medium thumbnail from the JPG
-	_, lmdErr := os.Stat(pp.PNG.Light.Medium)
-	if os.IsNotExist(lmdErr) {
-		mdResizeErr := resizePng(original, 666, pp.PNG.Light.Medium)
-		if mdResizeErr != nil {
-			log_error.Tracef("failed to resize jpg %v due to error %v", pp.PNG.Light.Medium, mdResizeErr)
-			return
-		}
-	}
+	// perceptual hashes of the page image are used to cluster repeated cover sheets and withdrawal notices
+	pp.PHash = formatFingerprint(perceptualHash(img))
+	pp.DHash = formatFingerprint(differenceHash(img))
 
-	// create the small thumbnail from the JPG
-	_, lsmErr := os.Stat(pp.PNG.Light.Small)
-	if os.IsNotExist(lsmErr) {
-		smResizeErr := resizePng(original, 333, pp.PNG.Light.Small)
-		if smResizeErr != nil {
-			log_error.Tracef("failed to resize jpg %v due to error %v", pp.PNG.Light.Small, smResizeErr)
-			return
-		}
+	resizeErr := resizeRenditions(img, pp.PNG.Light)
+	if resizeErr != nil {
+		log_error.Tracef("failed to resize %v due to error %v", pp.PNG.Light[c_rendition_original], resizeErr)
+		return
 	}
 
+	pp.Renditions.Light = describeRenditions(img, pp.PNG.Light)
 }
 
 func generateDarkThumbnails(ctx context.Context, pp PendingPage) {
@@ -335,75 +320,62 @@ func generateDarkThumbnails(ctx context.Context, pp PendingPage) {
 		}
 	}()
 	log_info.Printf("started generateDarkThumbnails(%v.%v) = %v", pp.RecordIdentifier, pp.Identifier, pp.PDFPath)
+	if skipBlankPage(pp, c_blank_step_thumbnails) {
+		log_info.Printf("skipping generateDarkThumbnails(%v.%v) because the page is blank", pp.RecordIdentifier, pp.Identifier)
+		return
+	}
 	// task: the pp.Light.Original into pp.Dark.Original
 
-	_, ppdoErr := os.Stat(pp.PNG.Dark.Original)
+	// the dark original is decoded once for its renditions and placeholders, or kept from its conversion
+	var dark image.Image
+	_, ppdoErr := os.Stat(pp.PNG.Dark[c_rendition_original])
 	if os.IsNotExist(ppdoErr) {
-		// convert REPLACE_WITH_OUTPUT_PNG_PAGE_FILENAME -channel rgba -matte -fill 'rgba(250,226,203,1)' -fuzz 45% -opaque 'rgba(76,76,76,1)' -flatten REPLACE_WITH_OUTPUT_PNG_DARK_PAGE_FILENAME
-		cmdA := exec.Command(m_required_binaries["convert"], pp.PNG.Light.Original, "-channel", "rgba", "-matte", "-fill", `rgba(250,226,203,1)`, "-fuzz", "45%", "-opaque", `rgba(76,76,76,1)`, "-flatten", pp.PNG.Dark.Original)
-		var cmdA_stdout bytes.Buffer
-		var cmdA_stderr bytes.Buffer
-		cmdA.Stdout = &cmdA_stdout
-		cmdA.Stderr = &cmdA_stderr
-		sem_convert.Acquire()
-		cmdA_err := cmdA.Run()
-		sem_convert.Release()
-		if cmdA_err != nil {
-			log_info.Tracef("failed to convert %v into %v due to error: %s\n", pp.PNG.Light.Original, pp.PNG.Dark.Original, cmdA_err)
+		light, lightErr := os.Open(pp.PNG.Light[c_rendition_original])
+		if lightErr != nil {
+			log_error.Tracef("failed to open %v due to error %v", pp.PNG.Light[c_rendition_original], lightErr)
 			return
 		}
-
-		// convert REPLACE_WITH_OUTPUT_PNG_DARK_PAGE_FILENAME -channel rgba -matte -fill 'rgba(40,40,86,1)' -fuzz 12% -opaque white -flatten REPLACE_WITH_OUTPUT_PNG_DARK_PAGE_FILENAME
-		cmdB := exec.Command(m_required_binaries["convert"], pp.PNG.Dark.Original, `-channel`, `rgba`, `-matte`, `-fill`, `rgba(40,40,86,1)`, `-fuzz`, `12%`, `-opaque`, `white`, `-flatten`, pp.PNG.Dark.Original)
-		var cmdB_stdout bytes.Buffer
-		var cmdB_stderr bytes.Buffer
-		cmdB.Stdout = &cmdB_stdout
-		cmdB.Stderr = &cmdB_stderr
-		sem_convert.Acquire()
-		cmdB_err := cmdB.Run()
-		sem_convert.Release()
-		if cmdB_err != nil {
-			log_error.Tracef("failed to convert %v into %v due to error: %s\n", pp.PNG.Light.Original, pp.PNG.Dark.Original, cmdB_err)
+		img, decodeErr := imaging.Decode(light)
+		_ = light.Close()
+		if decodeErr != nil {
+			log_error.Tracef("failed to decode %v due to error %v", pp.PNG.Light[c_rendition_original], decodeErr)
 			return
 		}
-	}
-
-	original, err := os.Open(pp.PNG.Dark.Original)
-	if err != nil {
-		log_error.Tracef("failed to open pp.OriginalPath(%v) due to error %v", pp.PNG.Dark.Original, err)
-		return
-	}
-
-	// create the large thumbnail from the JPG
-	_, dlgErr := os.Stat(pp.PNG.Dark.Large)
-	if os.IsNotExist(dlgErr) {
-		lgResizeErr := resizePng(original, 999, pp.PNG.Dark.Large)
-		if lgResizeErr != nil {
-			log_error.Tracef("failed to resize jpg %v due to error %v", pp.PNG.Dark.Large, lgResizeErr)
+		dark = ConvertToDarkMode(img, sl_dark_palette)
+		darkFile, createErr := os.Create(pp.PNG.Dark[c_rendition_original])
+		if createErr != nil {
+			log_error.Tracef("failed to create %v due to error %v", pp.PNG.Dark[c_rendition_original], createErr)
 			return
 		}
-	}
-
-	// create the medium thumbnail from the JPG
-	_, dmdErr := os.Stat(pp.PNG.Dark.Medium)
-	if os.IsNotExist(dmdErr) {
-		mdResizeErr := resizePng(original, 666, pp.PNG.Dark.Medium)
-		if mdResizeErr != nil {
-			log_error.Tracef("failed to resize jpg %v due to error %v", pp.PNG.Dark.Medium, mdResizeErr)
+		encodeErr := png.Encode(darkFile, dark)
+		closeErr := darkFile.Close()
+		if encodeErr != nil || closeErr != nil {
+			log_error.Tracef("failed to convert %v into %v due to error: %v %v", pp.PNG.Light[c_rendition_original], pp.PNG.Dark[c_rendition_original], encodeErr, closeErr)
+			_ = os.Remove(pp.PNG.Dark[c_rendition_original])
 			return
 		}
-	}
-
-	// create the small thumbnail from the JPG
-	_, dsmErr := os.Stat(pp.PNG.Dark.Small)
-	if os.IsNotExist(dsmErr) {
-		smResizeErr := resizePng(original, 333, pp.PNG.Dark.Small)
-		if smResizeErr != nil {
-			log_error.Tracef("failed to resize jpg %v due to error %v", pp.PNG.Dark.Small, smResizeErr)
+	} else {
+		original, err := os.Open(pp.PNG.Dark[c_rendition_original])
+		if err != nil {
+			log_error.Tracef("failed to open pp.OriginalPath(%v) due to error %v", pp.PNG.Dark[c_rendition_original], err)
+			return
+		}
+		defer original.Close()
+		img, decodeErr := imaging.Decode(original)
+		if decodeErr != nil {
+			log_error.Tracef("failed to decode %v due to error %v", pp.PNG.Dark[c_rendition_original], decodeErr)
 			return
 		}
+		dark = img
 	}
 
+	resizeErr := resizeRenditions(dark, pp.PNG.Dark)
+	if resizeErr != nil {
+		log_error.Tracef("failed to resize %v due to error %v", pp.PNG.Dark[c_rendition_original], resizeErr)
+		return
+	}
+
+	pp.Renditions.Dark = describeRenditions(dark, pp.PNG.Dark)
 }
 
 func performOcrOnPdf(ctx context.Context, pp PendingPage) {
@@ -418,6 +390,15 @@ func performOcrOnPdf(ctx context.Context, pp PendingPage) {
 		}
 	}()
 
+	if skipBlankPage(pp, c_blank_step_ocr) {
+		log_info.Printf("skipping performOcrOnPdf(%v.%v) because the page is blank", pp.RecordIdentifier, pp.Identifier)
+		write_err := write_string_to_file(pp.OCRTextPath, "")
+		if write_err != nil {
+			log_error.Tracef("failed to write the empty %v due to error %v", pp.OCRTextPath, write_err)
+		}
+		return
+	}
+
 	if ok, err := fileHasData(pp.OCRTextPath); !ok || err != nil {
 		/*
 			tesseract SRC DEST -l eng --psm 1
@@ -432,7 +413,7 @@ func performOcrOnPdf(ctx context.Context, pp PendingPage) {
 				return
 			}
 		}
-		src := pp.PNG.Light.Original
+		src := pp.PNG.Light[c_rendition_original]
 		dest := strings.TrimSuffix(pp.OCRTextPath, `.txt`)
 		cmd := exec.Command(m_required_binaries["tesseract"], src, dest, `-l`, `eng`, `--psm`, `1`)
 		var cmd_stdout bytes.Buffer
@@ -466,36 +447,49 @@ func convertPngToJpg(ctx context.Context, pp PendingPage) {
 		}
 	}()
 	log_info.Printf("started convertPngToJpg(%v.%v) = %v", pp.RecordIdentifier, pp.Identifier, pp.PDFPath)
-	files := map[string]string{
-		pp.PNG.Light.Original: pp.JPEG.Light.Original,
-		pp.PNG.Light.Large:    pp.JPEG.Light.Large,
-		pp.PNG.Light.Medium:   pp.JPEG.Light.Medium,
-		pp.PNG.Light.Small:    pp.JPEG.Light.Small,
-		pp.PNG.Light.Social:   pp.JPEG.Light.Social,
-		pp.PNG.Dark.Original:  pp.JPEG.Dark.Original,
-		pp.PNG.Dark.Large:     pp.JPEG.Dark.Large,
-		pp.PNG.Dark.Medium:    pp.JPEG.Dark.Medium,
-		pp.PNG.Dark.Small:     pp.JPEG.Dark.Small,
-		pp.PNG.Dark.Social:    pp.JPEG.Dark.Social,
+	if *flag_b_deep_zoom || len(*flag_s_iiif_base_url) > 0 {
+		pp = generateDeepZoom(pp)
+		pp = generateIIIFTiles(pp)
+		pp_save(pp)
 	}
-	for png, jpeg := range files {
-		if strings.HasSuffix(png, `social.png`) || strings.HasSuffix(jpeg, `social.jpg`) {
-			// TODO - skip social.png until its implemented
-			continue
-		}
-		f, e1 := os.Open(png)
-		if e1 != nil {
-			log_error.Tracef("failed to convertAndOptimizePNG for file %v due to error %v", png, e1)
-			continue
-		}
-		e2 := convertAndOptimizePNG(f, jpeg)
-		if e2 != nil {
-			log_error.Tracef("failed to convertAndOptimizePNG(%v) due to error %v", png, e2)
-			continue
+	for _, theme := range []string{c_theme_light, c_theme_dark} {
+		pngs := pp.PNG.Light
+		if theme == c_theme_dark {
+			pngs = pp.PNG.Dark
 		}
+		variants := pageVariants(pp, theme)
+		for name, png := range pngs {
+			if _, statErr := os.Stat(png); os.IsNotExist(statErr) {
+				if !skipBlankPage(pp, c_blank_step_thumbnails) {
+					log_error.Tracef("failed to encode %v because it does not exist", png)
+				}
+				dropVariants(variants, name, renditionFormats(name)...)
+				continue // thumbnails of blank pages are not generated with --blank-policy skip-all
+			}
+			encoded := true
+			for _, format := range renditionFormats(name) {
+				output, ok := variants[format][name]
+				if !ok {
+					continue
+				}
+				encoder := m_image_encoders[format]
+				if !encoder.Available() {
+					log_error.Printf("skipping %v because no local %v encoder is installed", output, format)
+					dropVariants(variants, name, format)
+					encoded = false
+					continue
+				}
+				err := encoder.Encode(png, output, renditionQuality(name))
+				if err != nil {
+					log_error.Tracef("failed to encode %v into %v due to error %v", png, output, err)
+					dropVariants(variants, name, format)
+					encoded = false
+				}
+			}
 
-		_, pngErr := os.Stat(png)
-		if !os.IsNotExist(pngErr) {
+			if !encoded || hasFormat(name, c_format_png) {
+				continue // renditions with the png format, or that failed to encode, keep their PNG image
+			}
 			e3 := os.Remove(png)
 			if e3 != nil {
 				log_error.Tracef("failed to remove PNG file %v due to error %v", png, e3)
@@ -503,6 +497,9 @@ func convertPngToJpg(ctx context.Context, pp PendingPage) {
 		}
 	}
 
+	pp.Renditions.Light = describeRenditionFiles(pp, c_theme_light, pp.Renditions.Light)
+	pp.Renditions.Dark = describeRenditionFiles(pp, c_theme_dark, pp.Renditions.Dark)
+
 }
 
 // compileDarkPDF TODO: need to implement this so page.dark.######.original.jpg can be combined into <filename>.dark.pdf
@@ -510,7 +507,8 @@ func compileDarkPDF() {
 
 }
 
-// generateSocialCard TODO: need to implement creating the social image card for X/Facebook/etc. when links are shared
+// generateSocialCard TODO: need to implement creating the social image card for X/Facebook/etc. when links are shared;
+// its description should come from the top Keywords of the page and of its record.json once analyze_collection has run
 func generateSocialCard() {
 
 }
@@ -0,0 +1,251 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"math"
+	"os"
+
+	"github.com/disintegration/imaging"
+	"github.com/pixiv/go-libjpeg/jpeg"
+)
+
+const (
+	c_blurhash_x       = 3  // horizontal BlurHash components
+	c_blurhash_y       = 4  // vertical BlurHash components; pages are taller than they are wide
+	c_blurhash_width   = 32 // width of the thumbnail that the BlurHash is computed from
+	c_lqip_width       = 16 // width of the base64 JPEG placeholder
+	c_lqip_quality     = 40
+	c_dominant_buckets = 4 // bits per channel that pixels are grouped by to find the dominant colour
+)
+
+const c_base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// base83 encodes value into length BlurHash digits
+func base83(value, length int) string {
+	out := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		out[i-1] = c_base83[digit]
+	}
+	return string(out)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+// blurHash encodes img into a BlurHash (https://blurha.sh) with componentsX x componentsY components
+func blurHash(img image.Image, componentsX, componentsY int) string {
+	small := imaging.Resize(img, c_blurhash_width, 0, imaging.Box)
+	width, height := small.Bounds().Dx(), small.Bounds().Dy()
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(width)) * math.Cos(math.Pi*float64(j*y)/float64(height))
+					offset := y*small.Stride + x*4
+					r += basis * srgbToLinear(small.Pix[offset])
+					g += basis * srgbToLinear(small.Pix[offset+1])
+					b += basis * srgbToLinear(small.Pix[offset+2])
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	hash := base83((componentsX-1)+(componentsY-1)*9, 1)
+	dc, ac := factors[0], factors[1:]
+	maximum := 1.0
+	if len(ac) > 0 {
+		var actual float64
+		for _, factor := range ac {
+			actual = math.Max(actual, math.Max(math.Abs(factor[0]), math.Max(math.Abs(factor[1]), math.Abs(factor[2]))))
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		hash += base83(quantised, 1)
+	} else {
+		hash += base83(0, 1)
+	}
+	hash += base83(linearToSrgb(dc[0])<<16+linearToSrgb(dc[1])<<8+linearToSrgb(dc[2]), 4)
+	for _, factor := range ac {
+		var quantised [3]int
+		for c := range factor {
+			quantised[c] = int(math.Max(0, math.Min(18, math.Floor(signPow(factor[c]/maximum, 0.5)*9+9.5))))
+		}
+		hash += base83(quantised[0]*19*19+quantised[1]*19+quantised[2], 2)
+	}
+	return hash
+}
+
+// lowQualityPlaceholder returns a tiny base64 JPEG data URI of img that the reader can show while a rendition loads
+func lowQualityPlaceholder(img image.Image) (string, error) {
+	small := imaging.Resize(img, c_lqip_width, 0, imaging.Box)
+	var buffer bytes.Buffer
+	err := jpeg.Encode(&buffer, nrgbaToRGBA(small), &jpeg.EncoderOptions{Quality: c_lqip_quality, OptimizeCoding: true})
+	if err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+// dominantColor groups the pixels of a thumbnail of img by their c_dominant_buckets most significant bits and returns
+// the average colour of the largest group as #rrggbb
+func dominantColor(img image.Image) string {
+	small := imaging.Resize(img, c_blurhash_width*2, 0, imaging.Box)
+	type bucket struct{ r, g, b, count int }
+	buckets := make(map[int]*bucket)
+	var largest *bucket
+	shift := 8 - c_dominant_buckets
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		r, g, b := int(small.Pix[i]), int(small.Pix[i+1]), int(small.Pix[i+2])
+		key := (r>>shift)<<(2*c_dominant_buckets) | (g>>shift)<<c_dominant_buckets | b>>shift
+		group, ok := buckets[key]
+		if !ok {
+			group = &bucket{}
+			buckets[key] = group
+		}
+		group.r, group.g, group.b, group.count = group.r+r, group.g+g, group.b+b, group.count+1
+		if largest == nil || group.count > largest.count {
+			largest = group
+		}
+	}
+	if largest == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", largest.r/largest.count, largest.g/largest.count, largest.b/largest.count)
+}
+
+// describeRenditions records the pixel dimensions of every rendition in images that exists along with the BlurHash,
+// LQIP and dominant colour of img; every rendition is the same page so they share the placeholder of the original
+func describeRenditions(img image.Image, images Images) map[string]Rendition {
+	placeholder := Rendition{
+		BlurHash:      blurHash(img, c_blurhash_x, c_blurhash_y),
+		DominantColor: dominantColor(img),
+	}
+	lqip, err := lowQualityPlaceholder(img)
+	if err != nil {
+		log_error.Tracef("failed to create the LQIP of %v due to error %v", images[c_rendition_original], err)
+	} else {
+		placeholder.LQIP = lqip
+	}
+
+	renditions := make(map[string]Rendition)
+	for name, path := range images {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		config, _, err := image.DecodeConfig(file)
+		_ = file.Close()
+		if err != nil {
+			log_error.Tracef("failed to read the dimensions of %v due to error %v", path, err)
+			continue
+		}
+		rendition := placeholder
+		rendition.Width, rendition.Height = config.Width, config.Height
+		renditions[name] = rendition
+	}
+	return renditions
+}
+
+// describeRenditionFiles records the DPI of every rendition of the theme and the format, byte size and SHA-256 of
+// each encoded image of it; it runs after the PNG renditions are encoded and removed
+func describeRenditionFiles(pp PendingPage, theme string, renditions map[string]Rendition) map[string]Rendition {
+	pngs := pp.PNG.Light
+	if theme == c_theme_dark {
+		pngs = pp.PNG.Dark
+	}
+	variants := pageVariants(pp, theme)
+	variants[c_format_png] = pngs
+	if renditions == nil {
+		renditions = make(map[string]Rendition)
+	}
+	var original Rendition
+
+	// the original comes first because the DPI of the other renditions is relative to its width
+	names := []string{c_rendition_original}
+	for name := range pngs {
+		if name != c_rendition_original {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		rendition := renditions[name]
+		rendition.Files = nil
+		for _, format := range renditionFormats(name) {
+			path, ok := variants[format][name]
+			if !ok {
+				continue
+			}
+			checksum, size, err := FileSha256(path)
+			if err != nil {
+				continue // blank pages, missing encoders and failed conversions leave no file behind
+			}
+			rendition.Files = append(rendition.Files, RenditionFile{Path: path, Format: format, Bytes: size, SHA256: checksum})
+			if rendition.Width == 0 && (format == c_format_jpg || format == c_format_png) {
+				if file, err := os.Open(path); err == nil {
+					if config, _, err := image.DecodeConfig(file); err == nil {
+						rendition.Width, rendition.Height = config.Width, config.Height
+					}
+					_ = file.Close()
+				}
+			}
+		}
+		if len(rendition.Files) == 0 && rendition.Width == 0 {
+			continue
+		}
+		if name == c_rendition_original {
+			original = rendition
+			rendition.DPI = float64(*flag_i_render_dpi)
+		} else if original.Width > 0 {
+			rendition.DPI = math.Round(float64(*flag_i_render_dpi)*float64(rendition.Width)/float64(original.Width)*100) / 100
+		}
+		renditions[name] = rendition
+	}
+	return renditions
+}
@@ -0,0 +1,80 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func Test_blurHash(t *testing.T) {
+	hash := blurHash(imaging.New(60, 80, color.White), c_blurhash_x, c_blurhash_y)
+	if len(hash) != 28 || hash[0] != 'T' || hash[2:6] != "TSUA" {
+		t.Errorf("blurHash(white) = %q, want a 3x4 hash with a white DC component", hash)
+	}
+	page := imaging.New(60, 80, color.White)
+	page = imaging.Paste(page, imaging.New(60, 20, color.Black), image.Pt(0, 0))
+	if other := blurHash(page, c_blurhash_x, c_blurhash_y); len(other) != 28 || other == hash {
+		t.Errorf("blurHash(page with a black header) = %q, want a different hash than %q", other, hash)
+	}
+}
+
+func Test_dominantColor(t *testing.T) {
+	page := imaging.New(100, 100, color.RGBA{R: 250, G: 240, B: 230, A: 255})
+	page = imaging.Paste(page, imaging.New(100, 30, color.Black), image.Pt(0, 0))
+	if got := dominantColor(page); got != "#faf0e6" {
+		t.Errorf("dominantColor() = %v, want #faf0e6", got)
+	}
+	lqip, err := lowQualityPlaceholder(page)
+	if err != nil || !strings.HasPrefix(lqip, "data:image/jpeg;base64,") {
+		t.Errorf("lowQualityPlaceholder() = %q, %v", lqip, err)
+	}
+}
+
+func Test_describeRenditionFiles(t *testing.T) {
+	dir := t.TempDir()
+	pp := PendingPage{
+		PNG:  PNG{Light: pageImages(dir, c_theme_light, 1, c_format_png, "")},
+		JPEG: JPEG{Light: pageImages(dir, c_theme_light, 1, c_format_jpg, c_format_jpg)},
+	}
+	if err := imaging.Save(imaging.New(1000, 1400, color.White), pp.JPEG.Light[c_rendition_original]); err != nil {
+		t.Fatal(err)
+	}
+	if err := imaging.Save(imaging.New(500, 700, color.White), pp.JPEG.Light["large"]); err != nil {
+		t.Fatal(err)
+	}
+
+	renditions := describeRenditionFiles(pp, c_theme_light, nil)
+	original, large := renditions[c_rendition_original], renditions["large"]
+	if original.Width != 1000 || original.DPI != float64(*flag_i_render_dpi) || len(original.Files) != 1 {
+		t.Errorf("describeRenditionFiles() original = %+v", original)
+	}
+	if large.Height != 700 || large.DPI != float64(*flag_i_render_dpi)/2 {
+		t.Errorf("describeRenditionFiles() large = %+v", large)
+	}
+	if file := large.Files[0]; file.Format != c_format_jpg || file.Bytes == 0 || len(file.SHA256) != 64 {
+		t.Errorf("describeRenditionFiles() large file = %+v", file)
+	}
+	if _, found := renditions["small"]; found {
+		t.Errorf("describeRenditionFiles() described the small rendition that was never written")
+	}
+}
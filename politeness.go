@@ -0,0 +1,228 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var ErrDisallowedByRobots = errors.New("robots.txt disallows the url")
+
+// robotsRules are the rules of a robots.txt that apply to the --user-agent
+type robotsRules struct {
+	rules []robotsRule
+	delay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int // patterns that are longer are more specific
+	pattern *regexp.Regexp
+}
+
+// host_limiter returns the token bucket that paces the requests to host; a --host-rps of 0 does not limit them
+func host_limiter(host string) *rate.Limiter {
+	limit := rate.Limit(*flag_f_host_rps)
+	if *flag_f_host_rps <= 0 {
+		limit = rate.Inf
+	}
+	limiter, _ := sm_host_limiters.LoadOrStore(host, rate.NewLimiter(limit, max(1, *flag_i_host_burst)))
+	return limiter.(*rate.Limiter)
+}
+
+// pause_host holds back every request to host until the Retry-After of a 429 or 503 response has passed
+func pause_host(host string, wait time.Duration) {
+	until := time.Now().Add(wait)
+	for {
+		current, loaded := sm_host_pauses.LoadOrStore(host, until)
+		if !loaded || !current.(time.Time).Before(until) || sm_host_pauses.CompareAndSwap(host, current, until) {
+			return
+		}
+	}
+}
+
+// polite_request sets the --user-agent of request, refuses it when robots.txt disallows it and waits for its turn
+// in the token bucket of its host
+func polite_request(ctx context.Context, client *http.Client, request *http.Request) error {
+	if len(*flag_s_user_agent) > 0 {
+		request.Header.Set("User-Agent", *flag_s_user_agent)
+	}
+	host := request.URL.Host
+	if *flag_b_robots {
+		rules := robots_rules(ctx, client, request.URL)
+		if !rules.allowed(request.URL) {
+			return fmt.Errorf("%w: %v", ErrDisallowedByRobots, request.URL)
+		}
+		if rules.delay > 0 {
+			if limiter := host_limiter(host); limiter.Limit() > rate.Every(rules.delay) {
+				limiter.SetLimit(rate.Every(rules.delay))
+			}
+		}
+	}
+	if until, ok := sm_host_pauses.Load(host); ok {
+		if wait := time.Until(until.(time.Time)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return host_limiter(host).Wait(ctx)
+}
+
+// parse_retry_after returns how long a Retry-After header of seconds or an HTTP date asks to wait
+func parse_retry_after(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(0, seconds)) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// robots_rules fetches and caches the robots.txt of the host of link; a robots.txt that cannot be read allows
+// everything
+func robots_rules(ctx context.Context, client *http.Client, link *url.URL) robotsRules {
+	robots := url.URL{Scheme: link.Scheme, Host: link.Host, Path: "/robots.txt"}
+	if rules, ok := sm_robots.Load(robots.String()); ok {
+		return rules.(robotsRules)
+	}
+	var rules robotsRules
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, robots.String(), nil)
+	if err == nil {
+		request.Header.Set("User-Agent", *flag_s_user_agent)
+		if response, err := client.Do(request); err == nil {
+			if response.StatusCode == http.StatusOK {
+				rules = parse_robots(io.LimitReader(response.Body, 512<<10), robots_agent(*flag_s_user_agent))
+			}
+			_ = response.Body.Close()
+		}
+	}
+	sm_robots.Store(robots.String(), rules)
+	return rules
+}
+
+// robots_agent is the product token of a User-Agent that robots.txt groups are matched against
+func robots_agent(user_agent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(user_agent), "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(token)
+}
+
+// parse_robots returns the rules of the group of robots.txt that names agent, or of the * group when none does
+func parse_robots(robots io.Reader, agent string) robotsRules {
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+	var groups []*group
+	var current *group
+	reading_agents := false
+	scanner := bufio.NewScanner(robots)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !reading_agents {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			reading_agents = true
+			continue
+		case "allow", "disallow":
+			if current != nil && len(value) > 0 {
+				current.rules.rules = append(current.rules.rules, robotsRule{
+					allow:   key == "allow",
+					length:  len(value),
+					pattern: robots_pattern(value),
+				})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); current != nil && err == nil && seconds > 0 && !math.IsInf(seconds, 0) {
+				current.rules.delay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+		reading_agents = false
+	}
+
+	var fallback robotsRules
+	for _, g := range groups {
+		for _, name := range g.agents {
+			if name != "*" && len(agent) > 0 && strings.Contains(agent, name) {
+				return g.rules
+			}
+			if name == "*" {
+				fallback = g.rules
+			}
+		}
+	}
+	return fallback
+}
+
+// robots_pattern matches the path of a URL from its start, where * is any text and a trailing $ is the end of it
+func robots_pattern(value string) *regexp.Regexp {
+	anchored := strings.HasSuffix(value, "$")
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(value, "$")), `\*`, ".*")
+	if anchored {
+		pattern += "$"
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// allowed applies the longest rule that matches the path of link; Allow wins a tie
+func (r robotsRules) allowed(link *url.URL) bool {
+	target := link.EscapedPath()
+	if len(link.RawQuery) > 0 {
+		target += "?" + link.RawQuery
+	}
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > length || (rule.length == length && rule.allow) {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow
+}
@@ -0,0 +1,135 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parse_robots(t *testing.T) {
+	robots := `# robots.txt
+User-agent: *
+Disallow: /
+
+User-agent: Googlebot
+User-agent: apario-writer
+Disallow: /readingroom/search
+Disallow: /*.zip$
+Allow: /readingroom/search/help
+Crawl-delay: 2.5
+`
+	rules := parse_robots(strings.NewReader(robots), robots_agent("apario-writer/1.0 (+mailto:foia@example.com)"))
+	tests := map[string]bool{
+		"/readingroom/docs/memo.pdf":   true,
+		"/readingroom/search?q=memo":   false,
+		"/readingroom/search/help":     true,
+		"/readingroom/release.zip":     false,
+		"/readingroom/release.zip?v=1": true,
+	}
+	for link, want := range tests {
+		parsed, _ := url.Parse(link)
+		if got := rules.allowed(parsed); got != want {
+			t.Errorf("allowed(%v) = %v, want %v", link, got, want)
+		}
+	}
+	if rules.delay != 2500*time.Millisecond {
+		t.Errorf("parse_robots() Crawl-delay = %v, want 2.5s", rules.delay)
+	}
+
+	everyone := parse_robots(strings.NewReader(robots), "otherbot")
+	if everyone.allowed(&url.URL{Path: "/readingroom/docs/memo.pdf"}) {
+		t.Errorf("parse_robots() did not fall back to the * group")
+	}
+}
+
+func Test_parse_retry_after(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"120": 2 * time.Minute,
+		now.Add(90 * time.Second).Format(http.TimeFormat): 90 * time.Second,
+		now.Add(-time.Hour).Format(http.TimeFormat):       0,
+		"":     0,
+		"soon": 0,
+	}
+	for value, want := range tests {
+		if got := parse_retry_after(value, now); got != want {
+			t.Errorf("parse_retry_after(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func Test_polite_request(t *testing.T) {
+	defer func(rps float64, robots bool) { *flag_f_host_rps, *flag_b_robots = rps, robots }(*flag_f_host_rps, *flag_b_robots)
+	*flag_f_host_rps, *flag_b_robots = 20, true
+
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+		case "/busy.pdf":
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write(testPDF(1))
+		}
+	}))
+	defer server.Close()
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/memo.pdf", nil)
+		if err := polite_request(context.Background(), server.Client(), request); err != nil {
+			t.Fatalf("polite_request() error = %v", err)
+		}
+		if request.Header.Get("User-Agent") != *flag_s_user_agent {
+			t.Errorf("polite_request() User-Agent = %q", request.Header.Get("User-Agent"))
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Errorf("polite_request() sent 3 requests in %v at --host-rps 20", elapsed)
+	}
+	if len(agents) != 1 || agents[0] != *flag_s_user_agent {
+		t.Errorf("robots.txt was fetched %d times with %v, want once with the --user-agent", len(agents), agents)
+	}
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/private/memo.pdf", nil)
+	if err := polite_request(context.Background(), server.Client(), request); !errors.Is(err, ErrDisallowedByRobots) {
+		t.Errorf("polite_request(/private/) = %v, want ErrDisallowedByRobots", err)
+	}
+
+	err := download_to(context.Background(), server.Client(), server.URL+"/busy.pdf", t.TempDir()+"/busy.pdf", 1<<20)
+	var status_err *HTTPStatusError
+	if !errors.As(err, &status_err) || !status_err.Temporary() || status_err.RetryAfter != time.Second {
+		t.Fatalf("download_to(429) = %v, want a temporary HTTPStatusError with a Retry-After of 1s", err)
+	}
+	started = time.Now()
+	request, _ = http.NewRequest(http.MethodGet, server.URL+"/memo.pdf", nil)
+	if err := polite_request(context.Background(), server.Client(), request); err != nil || time.Since(started) < 500*time.Millisecond {
+		t.Errorf("polite_request() after a Retry-After = %v after %v, want it to wait", err, time.Since(started))
+	}
+}
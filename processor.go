@@ -129,7 +129,7 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 	}
 	filename := filepath.Base(url_source.Path)
 	log_info.Printf("process_download_pdf(%v) has a filename of %v", source_url, filename)
-	if url_source.Scheme != "https" {
+	if url_source.Scheme != "https" && url_source.Scheme != "http" {
 		if len(source_url) > 0 {
 			// has a value, but it doesnt begin with http
 			log_error.Tracef("invalid source_url provided %v", source_url)
@@ -157,7 +157,7 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 	)
 
 	_, downloadedPdfErr := os.Stat(q_file_pdf)
-	if os.IsNotExist(downloadedPdfErr) {
+	if os.IsNotExist(downloadedPdfErr) || *flag_b_refetch {
 		log_info.Printf("downloading URL %v to %v", source_url, q_file_pdf)
 		err = downloadFile(ctx, source_url, q_file_pdf)
 		if err != nil {
@@ -165,6 +165,37 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 			return err
 		}
 	}
+	download := read_download_info(q_file_pdf)
+
+	metadata := make(map[string]string)
+	if len(metadata_json) > 0 {
+		metadata_bytes := bytes.NewBufferString(metadata_json).Bytes()
+		err = json.Unmarshal(metadata_bytes, &metadata)
+		metadata_bytes = nil
+		if err != nil {
+			log_error.Tracef("failed to parse the --metadata-json due to err %v", err)
+		}
+	}
+
+	publisher_checksum, checksum_err := check_publisher_checksum(ctx, ResultData{
+		Identifier:  identifier,
+		URL:         source_url,
+		DataDir:     recordDir,
+		URLChecksum: pdf_url_checksum,
+		PDFPath:     q_file_pdf,
+		RecordPath:  q_file_record,
+		Metadata:    metadata,
+		Download:    download,
+	})
+	if checksum_err != nil {
+		return checksum_err
+	}
+
+	if isScanImage(q_file_pdf) {
+		ctx = context.WithValue(ctx, CtxKey("publisher_checksum"), "") // verified above
+		ctx = context.WithValue(ctx, CtxKey("source_checksum"), publisher_checksum)
+		return process_import_images(ctx, filename, []string{q_file_pdf}, source_url, metadata_json)
+	}
 
 	// [-TO-DO-]: first the downloaded file must be scanned through a virus scanner, this will introduce a runtime requirement release process update
 	// TODO: ensure clamav is installed via the release upgrade script
@@ -181,6 +212,28 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 		}
 	}
 
+	var encrypted_pdf string
+	working_pdf, encrypted, unlock_err := unlock_pdf(ctx, q_file_pdf)
+	if errors.Is(unlock_err, ErrPDFPasswordRequired) {
+		return record_encrypted_pdf(ResultData{
+			Identifier:  identifier,
+			URL:         source_url,
+			DataDir:     recordDir,
+			URLChecksum: pdf_url_checksum,
+			PDFPath:     q_file_pdf,
+			RecordPath:  q_file_record,
+			Metadata:    metadata,
+		})
+	}
+	if unlock_err != nil {
+		log_error.Tracef("failed to decrypt %v due to err %v", q_file_pdf, unlock_err)
+		return unlock_err
+	}
+	if encrypted {
+		encrypted_pdf, q_file_pdf = q_file_pdf, working_pdf
+	}
+	signatures := verify_pdf_signatures(ctx, q_file_pdf, encrypted_pdf)
+
 	// [-TO-DO-]: analyze the metadata of the pdf file to determine totalPages, currently defaulting to 0
 	pdf_analysis, pdf_analysis_err := analyze_pdf_path(q_file_pdf)
 	if pdf_analysis_err != nil {
@@ -234,16 +287,6 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 		return pdf_close_err
 	}
 
-	metadata := make(map[string]string)
-	if len(metadata_json) > 0 {
-		metadata_bytes := bytes.NewBufferString(metadata_json).Bytes()
-		err = json.Unmarshal(metadata_bytes, &metadata)
-		metadata_bytes = nil
-		if err != nil {
-			log_error.Tracef("failed to parse the --metadata-json due to err %v", err)
-		}
-	}
-
 	pdf_text, pdf_text_err := extract_text_from_pdf(q_file_pdf)
 	if pdf_text_err != nil {
 		log_error.Tracef("pdf_text_err = %v", pdf_text_err)
@@ -277,7 +320,16 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 		RecordPath:        q_file_record,
 		Info:              *info,
 		Metadata:          metadata,
+		Encrypted:         encrypted,
+		EncryptedPDFPath:  encrypted_pdf,
+		Signatures:        signatures,
+		Download:          download,
+		PublisherChecksum: publisher_checksum,
 	}
+	if skip_duplicate_pdf(rd) {
+		return nil
+	}
+	rd = describe_pdf_contents(ctx, rd)
 	err = WriteResultDataToJson(rd)
 	if err != nil {
 		return err
@@ -291,7 +343,7 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 		CoverPageIdentifier: "",
 		Collection:          Collection{},
 	})
-	a_i_total_documents.Add(1)
+	count_document(ctx)
 	log_info.Printf("sending URL %v (rd struct) into the ch_ImportedRow channel", rd.URL)
 	err = ch_ImportedRow.Write(rd)
 	if err != nil {
@@ -301,10 +353,25 @@ func process_download_pdf(ctx context.Context, source_url string, metadata_json
 	return nil
 }
 
+// import_record_checksum returns the name of the directory in the --database-directory that process_import_pdf
+// imports the PDF at path into
+func import_record_checksum(ctx context.Context, path string) string {
+	pdf_url_checksum := Sha256(filepath.Base(path))
+	if parent_identifier, _ := ctx.Value(CtxKey("parent_identifier")).(string); len(parent_identifier) > 0 {
+		pdf_url_checksum = Sha256(path) // attachments of different documents often share a filename
+	}
+	if record_source, _ := ctx.Value(CtxKey("record_source")).(string); len(record_source) > 0 {
+		pdf_url_checksum = Sha256(record_source) // so do the entries of an archive and the converted documents
+	}
+	return pdf_url_checksum
+}
+
 func process_import_pdf(ctx context.Context, path string, metadata_json string) error {
 	//log.Printf("using ctx %v to process_import_pdf", ctx.Value(CtxKey("filename")))
 	basename := filepath.Base(path)
-	pdf_url_checksum := Sha256(basename)
+	pdf_url_checksum := import_record_checksum(ctx, path)
+	parent_identifier, _ := ctx.Value(CtxKey("parent_identifier")).(string)
+	parent_record_path, _ := ctx.Value(CtxKey("parent_record_path")).(string)
 	identifier := NewIdentifier(6)
 
 	recordDir := filepath.Join(*flag_s_database_directory, pdf_url_checksum)
@@ -371,6 +438,12 @@ func process_import_pdf(ctx context.Context, path string, metadata_json string)
 
 	//log.Println("process_import_pdf() q_pdf_file = " + q_file_pdf)
 
+	sources, _ := ctx.Value(CtxKey("sources")).([]string)
+	sources, sources_err := keep_sources(sources, filepath.Join(recordDir, "sources"))
+	if sources_err != nil {
+		return log_error.TraceReturnf("process_import_pdf keep_sources(%v) err: \n%+v", recordDir, sources_err)
+	}
+
 	// [-TO-DO-]: first the downloaded file must be scanned through a virus scanner, this will introduce a runtime requirement release process update
 	// TODO: ensure clamav is installed via the release upgrade script
 	if !*flag_b_disable_clamav {
@@ -384,6 +457,57 @@ func process_import_pdf(ctx context.Context, path string, metadata_json string)
 		}
 	}
 
+	metadata := make(map[string]string)
+	if len(metadata_json) > 0 {
+		metadata_bytes := bytes.NewBufferString(metadata_json).Bytes()
+		err = json.Unmarshal(metadata_bytes, &metadata)
+		metadata_bytes = nil
+		if err != nil {
+			log_debug.Tracef("failed to parse the --metadata-json due to err %v", err)
+		}
+	}
+
+	publisher_checksum, checksum_err := check_publisher_checksum(ctx, ResultData{
+		Identifier:       identifier,
+		DataDir:          recordDir,
+		URLChecksum:      pdf_url_checksum,
+		PDFPath:          q_file_pdf,
+		RecordPath:       q_file_record,
+		Metadata:         metadata,
+		ParentIdentifier: parent_identifier,
+		ParentRecordPath: parent_record_path,
+		Sources:          sources,
+	})
+	if checksum_err != nil {
+		return checksum_err
+	}
+	if source_checksum, ok := ctx.Value(CtxKey("source_checksum")).(*PublisherChecksum); ok && publisher_checksum == nil {
+		publisher_checksum = source_checksum // verified by check_source_checksum before the source was converted
+	}
+
+	var encrypted_pdf string
+	working_pdf, encrypted, unlock_err := unlock_pdf(ctx, q_file_pdf)
+	if errors.Is(unlock_err, ErrPDFPasswordRequired) {
+		return record_encrypted_pdf(ResultData{
+			Identifier:       identifier,
+			DataDir:          recordDir,
+			URLChecksum:      pdf_url_checksum,
+			PDFPath:          q_file_pdf,
+			RecordPath:       q_file_record,
+			Metadata:         metadata,
+			ParentIdentifier: parent_identifier,
+			ParentRecordPath: parent_record_path,
+			Sources:          sources,
+		})
+	}
+	if unlock_err != nil {
+		return log_error.TraceReturnf("failed to decrypt %v due to err %v", q_file_pdf, unlock_err)
+	}
+	if encrypted {
+		encrypted_pdf, q_file_pdf = q_file_pdf, working_pdf
+	}
+	signatures := verify_pdf_signatures(ctx, q_file_pdf, encrypted_pdf)
+
 	pdf_analysis, pdf_analysis_err := repair_then_analyze_pdf(q_file_pdf)
 	if pdf_analysis_err != nil {
 		return log_debug.TraceReturn(pdf_analysis_err)
@@ -423,16 +547,6 @@ func process_import_pdf(ctx context.Context, path string, metadata_json string)
 		return log_error.TraceReturn(pdf_file_close_err)
 	}
 
-	metadata := make(map[string]string)
-	if len(metadata_json) > 0 {
-		metadata_bytes := bytes.NewBufferString(metadata_json).Bytes()
-		err = json.Unmarshal(metadata_bytes, &metadata)
-		metadata_bytes = nil
-		if err != nil {
-			log_debug.Tracef("failed to parse the --metadata-json due to err %v", err)
-		}
-	}
-
 	pdf_text, pdf_text_err := extract_text_from_pdf(q_file_pdf)
 	if pdf_text_err != nil {
 		log_error.Tracef("pdf_text_err = %v", pdf_text_err)
@@ -463,7 +577,18 @@ func process_import_pdf(ctx context.Context, path string, metadata_json string)
 		RecordPath:        q_file_record,
 		Info:              info,
 		Metadata:          metadata,
+		Encrypted:         encrypted,
+		EncryptedPDFPath:  encrypted_pdf,
+		Signatures:        signatures,
+		ParentIdentifier:  parent_identifier,
+		ParentRecordPath:  parent_record_path,
+		Sources:           sources,
+		PublisherChecksum: publisher_checksum,
+	}
+	if skip_duplicate_pdf(rd) {
+		return nil
 	}
+	rd = describe_pdf_contents(ctx, rd)
 	err = WriteResultDataToJson(rd)
 	if err != nil {
 		return log_error.Return(err)
@@ -476,7 +601,7 @@ func process_import_pdf(ctx context.Context, path string, metadata_json string)
 		CoverPageIdentifier: "",
 		Collection:          Collection{},
 	})
-	a_i_total_documents.Add(1)
+	count_document(ctx)
 	log_info.Printf("sending URL %v (rd struct) into the ch_ImportedRow channel", rd.URL)
 	err = ch_ImportedRow.Write(rd)
 	if err != nil {
@@ -487,6 +612,7 @@ func process_import_pdf(ctx context.Context, path string, metadata_json string)
 
 func process_import_directory(ctx context.Context, directory string) error {
 	wg := countable_waitgroup.CountableWaitGroup{}
+	images := make(map[string][]string)
 	err := filepath.Walk(directory, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -503,15 +629,89 @@ func process_import_directory(ctx context.Context, directory string) error {
 			}(&wg)
 		}
 
+		if !info.IsDir() && (isOfficeDocument(path) || isEmail(path)) {
+			wg.Add(1)
+			go func(wg *countable_waitgroup.CountableWaitGroup) {
+				defer wg.Done()
+				process_err := process_import_file(ctx, path, "")
+				if process_err != nil {
+					return
+				}
+			}(&wg)
+		}
+
+		if !info.IsDir() && isScanImage(path) {
+			images[filepath.Dir(path)] = append(images[filepath.Dir(path)], path)
+		}
+
 		return nil
 	})
 	if err != nil {
 		return err
 	}
+
+	// the scanned images of each directory are imported once the walk has found all of them
+	for dir, paths := range images {
+		for _, sources := range scanDocuments(paths) {
+			name, origin := filepath.Base(dir), dir
+			if len(sources) == 1 {
+				name, origin = filepath.Base(sources[0]), sources[0]
+			}
+			if abs, abs_err := filepath.Abs(origin); abs_err == nil {
+				origin = abs
+			}
+			wg.Add(1)
+			go func(wg *countable_waitgroup.CountableWaitGroup, name, origin string, sources []string) {
+				defer wg.Done()
+				process_err := process_import_images(ctx, name, sources, origin, "")
+				if process_err != nil {
+					return
+				}
+			}(&wg, name, origin, sources)
+		}
+	}
 	wg.Wait()
 	return nil
 }
 
+// countedDocument is placed into the ctx of an import by the importers that add it to a_i_total_documents before
+// it is imported, such as process_crawl; the first document of the import that is sent into ch_ImportedRow claims it
+// instead of being counted again
+type countedDocument struct {
+	claimed atomic.Bool
+}
+
+// count_document adds the document that is about to be sent into ch_ImportedRow to a_i_total_documents unless it
+// claims the countedDocument of ctx
+func count_document(ctx context.Context) {
+	if counted, ok := ctx.Value(CtxKey("counted_document")).(*countedDocument); ok && counted != nil && counted.claimed.CompareAndSwap(false, true) {
+		return
+	}
+	a_i_total_documents.Add(1)
+}
+
+// process_import_file imports the PDF, office document, email or scanned image at path
+func process_import_file(ctx context.Context, path string, metadata_json string) error {
+	if isOfficeDocument(path) {
+		return process_import_office(ctx, path, metadata_json)
+	}
+	if isEmail(path) {
+		return process_import_email(ctx, path, metadata_json)
+	}
+	if !isScanImage(path) {
+		return process_import_pdf(ctx, path, metadata_json)
+	}
+	origin, _ := ctx.Value(CtxKey("record_source")).(string)
+	if len(origin) == 0 {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		origin = abs
+	}
+	return process_import_images(ctx, filepath.Base(path), []string{path}, origin, metadata_json)
+}
+
 // scan_path_with_clam_av scans the specified path with ClamAV and returns the results.
 func scan_path_with_clam_av(path string) (string, bool, error) {
 	// Prepare the clamscan command
@@ -568,24 +768,6 @@ func extract_text_from_pdf(path string) (string, error) {
 	return out.String(), nil
 }
 
-// optimize_pdf uses pdfcpu optimize against a PDF file path provided
-//
-//	pdfcpu optimize <path>
-func optimize_pdf(path string) error {
-	cmd2_optimize_pdf := exec.Command(m_required_binaries["pdfcpu"], "optimize", path)
-	var cmd2_optimize_pdf_stdout bytes.Buffer
-	var cmd2_optimize_pdf_stderr bytes.Buffer
-	cmd2_optimize_pdf.Stdout = &cmd2_optimize_pdf_stdout
-	cmd2_optimize_pdf.Stderr = &cmd2_optimize_pdf_stderr
-	sem_pdfcpu.Acquire()
-	cmd2_optimize_pdf_err := cmd2_optimize_pdf.Run()
-	sem_pdfcpu.Release()
-	if cmd2_optimize_pdf_err != nil {
-		return fmt.Errorf("Failed to execute command `pdfcpu optimize %v` due to error: %s\n", path, cmd2_optimize_pdf_err)
-	}
-	return nil
-}
-
 // prepare_pdf uses gs compatibility level 1.7 to prepare a PDF file path provided
 //
 //	gs -q -sDEVICE=pdfwrite -dCompatibilityLevel=1.7 -o <path> <path>
@@ -686,58 +868,6 @@ func analyze_then_repair_pdf(path string) (PDFCPUInfoResponse, error) {
 
 }
 
-// validate_pdf uses pdfcpu validate to verify a PDF file path provided
-//
-//	pdfcpu validate <path>
-func validate_pdf(path string) error {
-	cmd0_validate_pdf := exec.Command(m_required_binaries["pdfcpu"], "validate", path)
-	var cmd0_validate_pdf_stdout bytes.Buffer
-	var cmd0_validate_pdf_stderr bytes.Buffer
-	cmd0_validate_pdf.Stdout = &cmd0_validate_pdf_stdout
-	cmd0_validate_pdf.Stderr = &cmd0_validate_pdf_stderr
-	sem_pdfcpu.Acquire()
-	cmd0_validate_pdf_err := cmd0_validate_pdf.Run()
-	sem_pdfcpu.Release()
-
-	if cmd0_validate_pdf_err != nil {
-		return fmt.Errorf("Failed to execute `pdfcpu validate %v` due to error: %s\n", path, cmd0_validate_pdf_err)
-	}
-
-	if !strings.Contains(cmd0_validate_pdf_stdout.String(), "validation ok") {
-		return fmt.Errorf("failed to validate the pdf %v\n\tSTDOUT = %v", path, cmd0_validate_pdf_stdout.String())
-	}
-	return nil
-}
-
-// analyze_pdf_path uses the `pdfcpu` utility to determine properties about a PDF file.
-//
-//	pdfcpu info -json <path>
-func analyze_pdf_path(path string) (PDFCPUInfoResponse, error) {
-	cmd := exec.Command(m_required_binaries["pdfcpu"], "info", "-json", path)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	sem_pdfcpu.Acquire()
-	err := cmd.Run()
-	sem_pdfcpu.Release()
-	if err != nil {
-		return PDFCPUInfoResponse{}, err
-	}
-	outStr := string(out.Bytes())
-	jsonStartIndex := strings.Index(outStr, "{")
-	if jsonStartIndex == -1 {
-		return PDFCPUInfoResponse{}, fmt.Errorf("no JSON content found in pdfcpu output")
-	}
-
-	cleanJSON := outStr[jsonStartIndex:]
-	outStr = strings.TrimSpace(cleanJSON)
-	var pdf_info PDFCPUInfoResponse
-	pdf_info_err := json.Unmarshal([]byte(outStr), &pdf_info)
-	if pdf_info_err != nil {
-		return PDFCPUInfoResponse{}, pdf_info_err
-	}
-	return pdf_info, nil
-}
-
 func ProcessRow(headerFields []string, rowFields []string, rowWg *sync.WaitGroup, row chan []Column) {
 	defer rowWg.Done()
 	var d = map[string]string{}
@@ -131,7 +131,7 @@ func receiveOnGenerateLightCh(ctx context.Context, ch <-chan interface{}) {
 					log_error.Trace("cant typecast ipp to .(PendingPage)")
 					return
 				}
-				log_info.Printf("received on ch_GenerateLight, running generateLightThumbnails(%v) for ID %v (pgNo %d)", filepath.Base(pp.PNG.Light.Original), pp.Identifier, pp.PageNumber)
+				log_info.Printf("received on ch_GenerateLight, running generateLightThumbnails(%v) for ID %v (pgNo %d)", filepath.Base(pp.PNG.Light[c_rendition_original]), pp.Identifier, pp.PageNumber)
 				go generateLightThumbnails(ctx, pp)
 			} else {
 				log_debug.Trace("ch_GenerateLight is closed but received some data")
@@ -153,7 +153,7 @@ func receiveOnGenerateDarkCh(ctx context.Context, ch <-chan interface{}) {
 					log_error.Trace("cant typecast ipp to .(PendingPage)")
 					return
 				}
-				log_info.Printf("received on ch_GenerateDark, running generateDarkThumbnails(%v) for ID %v (pgNo %d)", filepath.Base(pp.PNG.Dark.Original), pp.Identifier, pp.PageNumber)
+				log_info.Printf("received on ch_GenerateDark, running generateDarkThumbnails(%v) for ID %v (pgNo %d)", filepath.Base(pp.PNG.Dark[c_rendition_original]), pp.Identifier, pp.PageNumber)
 				go generateDarkThumbnails(ctx, pp)
 			} else {
 				log_debug.Trace("ch_GenerateDark is closed but received some data")
@@ -21,6 +21,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -54,6 +55,14 @@ func process_custom_csv_row(ctx context.Context, row []Column) error {
 			continue
 		}
 	}
+	for _, column := range row {
+		if len(*flag_s_csv_column_password) > 0 && column.Header == *flag_s_csv_column_password && len(column.Value) > 0 {
+			ctx = context.WithValue(ctx, CtxKey("pdf_password"), column.Value)
+		}
+		if len(*flag_s_csv_column_checksum) > 0 && column.Header == *flag_s_csv_column_checksum && len(column.Value) > 0 {
+			ctx = context.WithValue(ctx, CtxKey("publisher_checksum"), column.Value)
+		}
+	}
 	metadata_marshal, marshal_err := json.Marshal(metadata)
 	if marshal_err != nil {
 		return marshal_err
@@ -85,7 +94,7 @@ func processRecord(ctx context.Context, row []Column) error {
 	loadedFile := fmt.Sprintf("%s", ctx.Value(CtxKey("filename")))
 
 	var totalPages int64 = 0
-	var filename, title, collection, pdf_url, source_url, comments, record_number, to_name, from_name, agency string
+	var filename, title, collection, pdf_url, source_url, comments, record_number, to_name, from_name, agency, password, publisher_checksum string
 	var creation_date, release_date time.Time
 
 	// header fields for different files
@@ -124,6 +133,10 @@ func processRecord(ctx context.Context, row []Column) error {
 			agency = r.Value
 		case "source_url", *flag_s_xlsx_column_url:
 			source_url = r.Value
+		case "password", *flag_s_xlsx_column_password:
+			password = r.Value
+		case "checksum", *flag_s_xlsx_column_checksum:
+			publisher_checksum = r.Value
 		case "creation_date", "Doc Date", "Document Date":
 			creation_date, dateErr = parseDateString(r.Value)
 			if dateErr != nil {
@@ -196,20 +209,14 @@ func processRecord(ctx context.Context, row []Column) error {
 	)
 
 	_, downloadedPdfErr := os.Stat(q_file_pdf)
-	if os.IsNotExist(downloadedPdfErr) {
+	if os.IsNotExist(downloadedPdfErr) || *flag_b_refetch {
 		log_debug.Printf("downloading URL %v to %v", pdf_url, q_file_pdf)
 		err = downloadFile(ctx, pdf_url, q_file_pdf)
 		if err != nil {
 			return err
 		}
 	}
-
-	pdfFile, pdfFileErr := os.Open(q_file_pdf)
-	if pdfFileErr != nil {
-		return pdfFileErr
-	}
-	checksum := FileSha512(pdfFile)
-	pdfFile.Close()
+	download := read_download_info(q_file_pdf)
 
 	metadata := make(map[string]string)
 	if len(title) > 0 {
@@ -239,6 +246,55 @@ func processRecord(ctx context.Context, row []Column) error {
 	if len(collection) > 0 {
 		metadata["collection"] = collection
 	}
+
+	if len(publisher_checksum) > 0 {
+		ctx = context.WithValue(ctx, CtxKey("publisher_checksum"), publisher_checksum)
+	}
+	verification, checksum_err := check_publisher_checksum(ctx, ResultData{
+		Identifier: identifier,
+		URL:        pdf_url,
+		DataDir:    recordDir,
+		PDFPath:    q_file_pdf,
+		RecordPath: q_file_record,
+		Metadata:   metadata,
+		Download:   download,
+	})
+	if checksum_err != nil {
+		a_i_total_documents.Add(-1) // counted by ReceiveRows but never sent into ch_ImportedRow
+		return checksum_err
+	}
+
+	if len(password) > 0 {
+		ctx = context.WithValue(ctx, CtxKey("pdf_password"), password)
+	}
+	var encrypted_pdf string
+	working_pdf, encrypted, unlock_err := unlock_pdf(ctx, q_file_pdf)
+	if errors.Is(unlock_err, ErrPDFPasswordRequired) {
+		a_i_total_documents.Add(-1) // counted by ReceiveRows but never sent into ch_ImportedRow
+		return record_encrypted_pdf(ResultData{
+			Identifier: identifier,
+			URL:        pdf_url,
+			DataDir:    recordDir,
+			PDFPath:    q_file_pdf,
+			RecordPath: q_file_record,
+			Metadata:   metadata,
+		})
+	}
+	if unlock_err != nil {
+		return unlock_err
+	}
+	if encrypted {
+		encrypted_pdf, q_file_pdf = q_file_pdf, working_pdf
+	}
+	signatures := verify_pdf_signatures(ctx, q_file_pdf, encrypted_pdf)
+
+	pdfFile, pdfFileErr := os.Open(q_file_pdf)
+	if pdfFileErr != nil {
+		return pdfFileErr
+	}
+	checksum := FileSha512(pdfFile)
+	pdfFile.Close()
+
 	rd := ResultData{
 		Identifier:        identifier,
 		URL:               pdf_url,
@@ -250,7 +306,17 @@ func processRecord(ctx context.Context, row []Column) error {
 		ExtractedTextPath: q_file_extracted,
 		RecordPath:        q_file_record,
 		Metadata:          metadata,
+		Encrypted:         encrypted,
+		EncryptedPDFPath:  encrypted_pdf,
+		Signatures:        signatures,
+		Download:          download,
+		PublisherChecksum: verification,
+	}
+	if skip_duplicate_pdf(rd) {
+		a_i_total_documents.Add(-1) // counted by ReceiveRows but never sent into ch_ImportedRow
+		return nil
 	}
+	rd = describe_pdf_contents(ctx, rd)
 	err = WriteResultDataToJson(rd)
 	if err != nil {
 		return err
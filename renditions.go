@@ -0,0 +1,295 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	c_rendition_original = "original" // the full --render-dpi page image that every rendition is resized from
+	c_theme_light        = "light"
+	c_theme_dark         = "dark"
+	c_format_jpg         = "jpg"
+	c_format_png         = "png"
+	c_format_webp        = "webp"
+	c_format_avif        = "avif"
+)
+
+// RenditionProfile is one resized page image that the writer generates for the reader. Profiles are defined in the
+// --config file under the `renditions` key:
+//
+//	renditions:
+//	  - name: retina
+//	    width: 1600
+//	    format: jpg
+//	    quality: 90
+//	    themes: [light, dark]
+//	  - name: tile
+//	    height: 150
+//	    formats: [webp, avif, jpg]
+//	    themes: [light]
+//
+// When only width or height is set the other side keeps the aspect ratio of the page; with both the page fits inside
+// the box. Renditions without a quality use --jpeg-quality. Every format in Formats is written next to Format so the
+// reader can offer them as <picture> sources.
+type RenditionProfile struct {
+	Name    string   `json:"name" yaml:"name"`
+	Width   int      `json:"width,omitempty" yaml:"width"`
+	Height  int      `json:"height,omitempty" yaml:"height"`
+	Format  string   `json:"format,omitempty" yaml:"format"`
+	Formats []string `json:"formats,omitempty" yaml:"formats"`
+	Quality int      `json:"quality,omitempty" yaml:"quality"`
+	Themes  []string `json:"themes,omitempty" yaml:"themes"`
+}
+
+// default_rendition_profiles are the large, medium and small renditions that the reader has always used
+func default_rendition_profiles() []RenditionProfile {
+	return []RenditionProfile{
+		{Name: "large", Width: 999, Format: c_format_jpg, Formats: []string{c_format_jpg}, Themes: []string{c_theme_light, c_theme_dark}},
+		{Name: "medium", Width: 666, Format: c_format_jpg, Formats: []string{c_format_jpg}, Themes: []string{c_theme_light, c_theme_dark}},
+		{Name: "small", Width: 333, Format: c_format_jpg, Formats: []string{c_format_jpg}, Themes: []string{c_theme_light, c_theme_dark}},
+	}
+}
+
+// load_rendition_profiles reads the `renditions` key of the --config file into sl_rendition_profiles; without a
+// config file, or when the key is missing, the default_rendition_profiles are used
+func load_rendition_profiles(configFile string) error {
+	sl_rendition_profiles = default_rendition_profiles()
+	formats, err := parseFormats(strings.Split(*flag_s_original_formats, ","))
+	if err != nil {
+		return fmt.Errorf("--original-formats %v", err)
+	}
+	sl_original_formats = formats
+	if len(configFile) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Renditions []RenditionProfile `json:"renditions" yaml:"renditions"`
+	}
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		// .ini files have no way to describe a list of profiles
+		log.Printf("WARNING: using the default rendition profiles because the renditions can only be read from a .json, .yaml or .yml --config, not %v", configFile)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse the renditions of %v: %v", configFile, err)
+	}
+	if len(file.Renditions) == 0 {
+		return nil
+	}
+	profiles := make([]RenditionProfile, 0, len(file.Renditions))
+	names := make(map[string]bool)
+	for _, profile := range file.Renditions {
+		profile.Name = strings.ToLower(strings.TrimSpace(profile.Name))
+		switch {
+		case len(profile.Name) == 0:
+			return fmt.Errorf("rendition profile without a name in %v", configFile)
+		case profile.Name == c_rendition_original:
+			return fmt.Errorf("rendition profile name %q is reserved for the --render-dpi page image", c_rendition_original)
+		case names[profile.Name]:
+			return fmt.Errorf("rendition profile %q is defined more than once", profile.Name)
+		case profile.Width < 0 || profile.Height < 0 || (profile.Width == 0 && profile.Height == 0):
+			return fmt.Errorf("rendition profile %q requires a positive width or height", profile.Name)
+		case profile.Quality < 0 || profile.Quality > 100:
+			return fmt.Errorf("rendition profile %q quality must be 1-100", profile.Name)
+		}
+		if len(profile.Format) == 0 && len(profile.Formats) == 0 {
+			profile.Format = c_format_jpg
+		}
+		formats, err := parseFormats(append([]string{profile.Format}, profile.Formats...))
+		if err != nil {
+			return fmt.Errorf("rendition profile %q %v", profile.Name, err)
+		}
+		profile.Format, profile.Formats = formats[0], formats
+		if len(profile.Themes) == 0 {
+			profile.Themes = []string{c_theme_light, c_theme_dark}
+		}
+		for _, theme := range profile.Themes {
+			if theme != c_theme_light && theme != c_theme_dark {
+				return fmt.Errorf("rendition profile %q has an unknown theme %q", profile.Name, theme)
+			}
+		}
+		names[profile.Name] = true
+		profiles = append(profiles, profile)
+	}
+	sl_rendition_profiles = profiles
+	return nil
+}
+
+// renditionProfile returns the profile called name
+func renditionProfile(name string) (RenditionProfile, bool) {
+	for _, profile := range sl_rendition_profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return RenditionProfile{}, false
+}
+
+// hasTheme returns true when the profile is generated for the theme
+func (profile RenditionProfile) hasTheme(theme string) bool {
+	for _, t := range profile.Themes {
+		if t == theme {
+			return true
+		}
+	}
+	return false
+}
+
+// renditionFormats returns the formats that the rendition called name is written in
+func renditionFormats(name string) []string {
+	if name == c_rendition_original {
+		return sl_original_formats
+	}
+	if profile, found := renditionProfile(name); found {
+		return profile.Formats
+	}
+	return nil
+}
+
+// hasFormat returns true when the rendition called name is written in format
+func hasFormat(name, format string) bool {
+	for _, f := range renditionFormats(name) {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFormats normalizes the image formats in, ignoring blanks and repeats, and rejects unsupported formats
+func parseFormats(in []string) ([]string, error) {
+	var formats []string
+	seen := make(map[string]bool)
+	for _, format := range in {
+		format = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(format)), ".")
+		if format == "jpeg" {
+			format = c_format_jpg
+		}
+		if len(format) == 0 || seen[format] {
+			continue
+		}
+		if _, ok := m_image_encoders[format]; !ok && format != c_format_png {
+			return nil, fmt.Errorf("has an unsupported format %q", format)
+		}
+		seen[format] = true
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("has no formats")
+	}
+	return formats, nil
+}
+
+// unavailableFormats returns the formats of --original-formats and the rendition profiles whose encoder is not
+// installed, such as avif without `avifenc`
+func unavailableFormats() []string {
+	formats := append([]string{}, sl_original_formats...)
+	for _, profile := range sl_rendition_profiles {
+		formats = append(formats, profile.Formats...)
+	}
+	var unavailable []string
+	seen := make(map[string]bool)
+	for _, format := range formats {
+		encoder, ok := m_image_encoders[format]
+		if !ok || seen[format] || encoder.Available() {
+			continue
+		}
+		seen[format] = true
+		unavailable = append(unavailable, format)
+	}
+	return unavailable
+}
+
+// renditionQuality returns the JPEG quality of the rendition called name, falling back to --jpeg-quality
+func renditionQuality(name string) int {
+	if profile, found := renditionProfile(name); found && profile.Quality > 0 {
+		return profile.Quality
+	}
+	return *flag_g_jpg_quality
+}
+
+// pageImages returns the path of the original and every rendition of the theme for page pgNo with the extension
+// ext; when onlyFormat is set, renditions that are not written in that format are left out
+func pageImages(pagesDir, theme string, pgNo int, ext, onlyFormat string) Images {
+	images := Images{}
+	if len(onlyFormat) == 0 || hasFormat(c_rendition_original, onlyFormat) {
+		images[c_rendition_original] = filepath.Join(pagesDir, fmt.Sprintf("page.%v.%06d.%v.%v", theme, pgNo, c_rendition_original, ext))
+	}
+	for _, profile := range sl_rendition_profiles {
+		if !profile.hasTheme(theme) || (len(onlyFormat) > 0 && !hasFormat(profile.Name, onlyFormat)) {
+			continue
+		}
+		images[profile.Name] = filepath.Join(pagesDir, fmt.Sprintf("page.%v.%06d.%v.%v", theme, pgNo, profile.Name, ext))
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	return images
+}
+
+// pageVariants returns the encoded images of the theme of pp by format
+func pageVariants(pp PendingPage, theme string) map[string]Images {
+	if theme == c_theme_dark {
+		return map[string]Images{c_format_jpg: pp.JPEG.Dark, c_format_webp: pp.WEBP.Dark, c_format_avif: pp.AVIF.Dark}
+	}
+	return map[string]Images{c_format_jpg: pp.JPEG.Light, c_format_webp: pp.WEBP.Light, c_format_avif: pp.AVIF.Light}
+}
+
+// dropVariants removes the name rendition of formats from variants so pp_save does not list images that were never written
+func dropVariants(variants map[string]Images, name string, formats ...string) {
+	for _, format := range formats {
+		delete(variants[format], name)
+	}
+}
+
+// resizeRenditions resizes the decoded original into every rendition of images that does not exist yet
+func resizeRenditions(original image.Image, images Images) error {
+	for _, profile := range sl_rendition_profiles {
+		path, ok := images[profile.Name]
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+		err := resizePng(original, profile.Width, profile.Height, path)
+		if err != nil {
+			return fmt.Errorf("failed to create the %v rendition %v: %v", profile.Name, path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_load_rendition_profiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(path, []byte("database-directory: /tmp\nrenditions:\n  - name: Retina\n    width: 1600\n  - name: tile\n    height: 150\n    format: png\n    formats: [webp, JPEG]\n    themes: [light]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { sl_rendition_profiles = default_rendition_profiles() }()
+
+	if err := load_rendition_profiles(path); err != nil {
+		t.Fatalf("load_rendition_profiles() error = %v", err)
+	}
+	if len(sl_rendition_profiles) != 2 {
+		t.Fatalf("load_rendition_profiles() loaded %d profiles, want 2", len(sl_rendition_profiles))
+	}
+	retina, found := renditionProfile("retina")
+	if !found || retina.Format != c_format_jpg || !retina.hasTheme(c_theme_dark) {
+		t.Errorf("renditionProfile(retina) = %+v, want a jpg rendition of both themes", retina)
+	}
+
+	tile, _ := renditionProfile("tile")
+	if want := []string{c_format_png, c_format_webp, c_format_jpg}; fmt.Sprint(tile.Formats) != fmt.Sprint(want) {
+		t.Errorf("renditionProfile(tile).Formats = %v, want %v", tile.Formats, want)
+	}
+	if webp := pageImages(dir, c_theme_light, 7, c_format_webp, c_format_webp); len(webp) != 1 || len(webp["tile"]) == 0 {
+		t.Errorf("pageImages(light, webp) = %v, want the tile only", webp)
+	}
+
+	light := pageImages(dir, c_theme_light, 7, c_format_jpg, c_format_jpg)
+	if len(light) != 3 || light["retina"] != filepath.Join(dir, "page.light.000007.retina.jpg") {
+		t.Errorf("pageImages(light, jpg) = %v", light)
+	}
+	dark := pageImages(dir, c_theme_dark, 7, c_format_png, "")
+	if _, ok := dark["tile"]; ok || len(dark) != 2 {
+		t.Errorf("pageImages(dark, png) = %v, want the original and retina only", dark)
+	}
+
+	ini := filepath.Join(dir, "config.ini")
+	_ = os.WriteFile(ini, []byte("database-directory=/tmp\n"), 0644)
+	log.SetOutput(io.Discard)
+	err = load_rendition_profiles(ini)
+	log.SetOutput(os.Stderr)
+	if err != nil || fmt.Sprint(sl_rendition_profiles) != fmt.Sprint(default_rendition_profiles()) {
+		t.Errorf("load_rendition_profiles(ini) = %v with %v, want the default profiles", err, sl_rendition_profiles)
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	_ = os.WriteFile(invalid, []byte("renditions:\n  - name: original\n    width: 10\n"), 0644)
+	if err := load_rendition_profiles(invalid); err == nil {
+		t.Errorf("load_rendition_profiles() accepted the reserved name original")
+	}
+	_ = os.WriteFile(invalid, []byte("renditions:\n  - name: huge\n    width: 10\n    formats: [gif]\n"), 0644)
+	if err := load_rendition_profiles(invalid); err == nil {
+		t.Errorf("load_rendition_profiles() accepted the unsupported format gif")
+	}
+}
+
+func Test_dropVariants(t *testing.T) {
+	var pp PendingPage
+	pp.JPEG.Light = Images{c_rendition_original: "page.jpg", "social": "social.jpg"}
+	pp.WEBP.Light = Images{c_rendition_original: "page.webp"}
+	pp.AVIF.Light = Images{c_rendition_original: "page.avif"}
+
+	variants := pageVariants(pp, c_theme_light)
+	dropVariants(variants, c_rendition_original, c_format_webp, c_format_avif)
+	if len(pp.WEBP.Light) != 0 || len(pp.AVIF.Light) != 0 {
+		t.Errorf("dropVariants() left %v and %v in the page", pp.WEBP.Light, pp.AVIF.Light)
+	}
+	if len(pp.JPEG.Light) != 2 {
+		t.Errorf("dropVariants() removed the jpg renditions %v", pp.JPEG.Light)
+	}
+	dropVariants(pageVariants(pp, c_theme_dark), c_rendition_original, c_format_jpg) // the dark images are nil
+}
+
+func Test_unavailableFormats(t *testing.T) {
+	defer func(formats []string, binaries map[string]string) {
+		sl_original_formats, sl_rendition_profiles, m_optional_binaries = formats, default_rendition_profiles(), binaries
+	}(sl_original_formats, m_optional_binaries)
+	m_optional_binaries = map[string]string{"cwebp": "/usr/bin/cwebp"}
+	sl_original_formats = []string{c_format_png, c_format_jpg, c_format_avif}
+	sl_rendition_profiles = append(default_rendition_profiles(), RenditionProfile{Name: "tile", Width: 150, Format: c_format_webp, Formats: []string{c_format_webp, c_format_avif}})
+
+	if got := unavailableFormats(); fmt.Sprint(got) != fmt.Sprint([]string{c_format_avif}) {
+		t.Errorf("unavailableFormats() = %v, want avif only", got)
+	}
+	m_optional_binaries = map[string]string{}
+	if got := unavailableFormats(); fmt.Sprint(got) != fmt.Sprint([]string{c_format_avif, c_format_webp}) {
+		t.Errorf("unavailableFormats() = %v, want avif and webp", got)
+	}
+}
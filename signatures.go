@@ -0,0 +1,179 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// load_signature_trust_store loads every .pem, .p7c, .crt and .cer certificate inside dir as the root certificates
+// that signatures are validated against; without a dir no certificate chain is trusted
+func load_signature_trust_store(dir string) error {
+	pool := x509.NewCertPool()
+	if len(dir) > 0 {
+		if !IsDir(dir) {
+			return errors.New("--signature-trust-store is not a directory: " + dir)
+		}
+		if _, err := pdfcpu.LoadCertificatesToCertPool(dir, pool); err != nil {
+			return err
+		}
+	}
+	model.UserCertPool = pool
+	return nil
+}
+
+// validate_pdf_signatures uses pdfcpu to validate every digital signature of the PDF file path provided offline
+// against the --signature-trust-store; nil is returned for PDFs without signatures. It must run before the PDF is
+// repaired or optimized because rewriting the file invalidates its signatures
+func validate_pdf_signatures(path, password string) (*SignatureReport, error) {
+	if model.UserCertPool == nil {
+		return nil, &PDFError{Op: "signatures", Path: path, Err: errors.New("the signature trust store is not loaded")}
+	}
+	conf := pdfcpu_configuration()
+	conf.UserPW, conf.OwnerPW = password, password
+	conf.Offline = true
+
+	response, err := analyze_pdf_path(path)
+	if err == nil && len(response.Infos) > 0 && !response.Infos[0].Signatures && !response.Infos[0].AppendOnly {
+		return nil, nil
+	}
+
+	sem_pdfcpu.Acquire()
+	results, err := api.ValidateSignatures(path, true, conf)
+	sem_pdfcpu.Release()
+	if err != nil {
+		return nil, &PDFError{Op: "signatures", Path: path, Err: err}
+	}
+	return signature_report(results), nil
+}
+
+// verify_pdf_signatures validates the signatures of the PDF as it was imported, which is the encrypted original when
+// unlock_pdf decrypted it into the working copy pdf_path
+func verify_pdf_signatures(ctx context.Context, pdf_path, encrypted_pdf string) *SignatureReport {
+	signed_pdf := pdf_path
+	if len(encrypted_pdf) > 0 {
+		signed_pdf = encrypted_pdf
+	}
+	report, err := validate_pdf_signatures(signed_pdf, pdf_password(ctx))
+	if err != nil {
+		log_error.Tracef("failed to validate the signatures of %v due to err %v", signed_pdf, err)
+		return nil
+	}
+	if report != nil {
+		log_info.Printf("validated %d signatures of %v (authentic = %v)", len(report.Signatures), signed_pdf, report.Authentic)
+	}
+	return report
+}
+
+// signature_report summarizes the pdfcpu validation results; the document is authentic when it has at least one
+// signature and every signature is valid, which requires a trusted certificate chain and no modification since signing
+func signature_report(results []*model.SignatureValidationResult) *SignatureReport {
+	report := &SignatureReport{ValidatedAt: time.Now().UTC()}
+	signed := 0
+	authentic := true
+	for _, result := range results {
+		signature := PDFSignature{
+			Type:             signature_type(result.Signature.Type),
+			Signed:           result.Signed,
+			Certified:        result.Signature.Certified,
+			Visible:          result.Visible,
+			Page:             result.PageNr,
+			Status:           signature_status(result.Status),
+			Reason:           result.Reason.String(),
+			DocumentModified: signature_bool(result.DocModified),
+			Signer:           result.Details.SignerIdentity,
+			SignerName:       result.Details.SignerName,
+			Location:         result.Details.Location,
+			ContactInfo:      result.Details.ContactInfo,
+			SigningReason:    result.Details.Reason,
+			Problems:         result.Problems,
+		}
+		if !result.Details.SigningTime.IsZero() {
+			signing_time := result.Details.SigningTime.UTC()
+			signature.SigningTime = &signing_time
+		}
+		for _, signer := range result.Details.Signers {
+			if signer.HasTimestamp && !signer.Timestamp.IsZero() {
+				timestamp := signer.Timestamp.UTC()
+				signature.Timestamp = &timestamp
+			}
+			for certificate := signer.Certificate; certificate != nil; certificate = certificate.IssuerCertificate {
+				signature.Certificates = append(signature.Certificates, SignatureCertificate{
+					Subject:      certificate.Subject,
+					Issuer:       certificate.Issuer,
+					SerialNumber: certificate.SerialNumber,
+					ValidFrom:    certificate.ValidFrom.UTC(),
+					ValidThru:    certificate.ValidThru.UTC(),
+					Expired:      certificate.Expired,
+					SelfSigned:   certificate.SelfSigned,
+					Trusted:      signature_bool(certificate.Trust.Status),
+					Revocation:   signature_bool(certificate.Revocation.Status),
+				})
+			}
+			signature.Problems = append(signature.Problems, signer.Problems...)
+		}
+		if result.Signed {
+			signed++
+			authentic = authentic && result.Status == model.SignatureStatusValid
+		}
+		report.Signatures = append(report.Signatures, signature)
+	}
+	report.Authentic = signed > 0 && authentic
+	return report
+}
+
+func signature_type(signature_type int) string {
+	switch signature_type {
+	case model.SigTypeForm:
+		return "form"
+	case model.SigTypePage:
+		return "page"
+	case model.SigTypeUR:
+		return "usage_rights"
+	}
+	return "document_timestamp"
+}
+
+func signature_status(status model.SignatureStatus) string {
+	switch status {
+	case model.SignatureStatusValid:
+		return "valid"
+	case model.SignatureStatusInvalid:
+		return "invalid"
+	}
+	return "unknown"
+}
+
+// signature_bool maps the pdfcpu tri-state of the trust, revocation and modification checks to "true", "false" or
+// "unknown"; a revocation of "true" means the certificate passed the revocation check
+func signature_bool(status int) string {
+	switch status {
+	case model.True:
+		return "true"
+	case model.False:
+		return "false"
+	}
+	return "unknown"
+}
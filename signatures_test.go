@@ -0,0 +1,123 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func Test_load_signature_trust_store(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Records Office Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "root.pem"), root, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "README.txt"), []byte("ignored"), 0644)
+
+	if err := load_signature_trust_store(dir); err != nil {
+		t.Fatalf("load_signature_trust_store() error = %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	if _, err := certificate.Verify(x509.VerifyOptions{Roots: model.UserCertPool}); err != nil {
+		t.Errorf("the trust store does not contain root.pem: %v", err)
+	}
+	if err := load_signature_trust_store(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("load_signature_trust_store(missing) expected an error")
+	}
+	if err := load_signature_trust_store(""); err != nil || model.UserCertPool == nil {
+		t.Errorf("load_signature_trust_store(\"\") = %v, want an empty trust store", err)
+	}
+
+	unsigned := filepath.Join(dir, "unsigned.pdf")
+	if err := os.WriteFile(unsigned, testPDF(1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := validate_pdf_signatures(unsigned, ""); err != nil || report != nil {
+		t.Errorf("validate_pdf_signatures(unsigned) = %+v, %v, want no report", report, err)
+	}
+}
+
+func Test_signature_report(t *testing.T) {
+	signedAt := time.Date(2017, 10, 26, 12, 0, 0, 0, time.UTC)
+	root := &model.CertificateDetails{Subject: "Records Office Root CA", SelfSigned: true, Trust: model.TrustDetails{Status: model.True}}
+	leaf := &model.CertificateDetails{Subject: "Archivist", Issuer: "Records Office Root CA", IssuerCertificate: root, Trust: model.TrustDetails{Status: model.True}}
+	valid := &model.SignatureValidationResult{
+		Signature:   model.Signature{Type: model.SigTypePage, Signed: true, Certified: true, PageNr: 1},
+		Status:      model.SignatureStatusValid,
+		Reason:      model.SignatureReasonDocNotModified,
+		DocModified: model.False,
+		Details: model.SignatureDetails{
+			SignerName:  "Archivist",
+			SigningTime: signedAt,
+			Signers:     []*model.Signer{{Certificate: leaf, HasTimestamp: true, Timestamp: signedAt}},
+		},
+	}
+	unsigned := &model.SignatureValidationResult{Signature: model.Signature{Type: model.SigTypeForm}, Status: model.SignatureStatusUnknown}
+
+	report := signature_report([]*model.SignatureValidationResult{valid, unsigned})
+	if !report.Authentic || len(report.Signatures) != 2 {
+		t.Fatalf("signature_report() = %+v, want an authentic report of 2 signatures", report)
+	}
+	signature := report.Signatures[0]
+	if signature.Type != "page" || signature.Status != "valid" || signature.DocumentModified != "false" || !signature.SigningTime.Equal(signedAt) || signature.Timestamp == nil {
+		t.Errorf("signature_report() signature = %+v", signature)
+	}
+	if len(signature.Certificates) != 2 || signature.Certificates[0].Subject != "Archivist" || signature.Certificates[1].Trusted != "true" {
+		t.Errorf("signature_report() certificates = %+v, want the chain from the signer to the root", signature.Certificates)
+	}
+	if report.Signatures[1].Type != "form" || report.Signatures[1].Status != "unknown" {
+		t.Errorf("signature_report() unsigned field = %+v", report.Signatures[1])
+	}
+
+	modified := *valid
+	modified.Status, modified.Reason, modified.DocModified = model.SignatureStatusInvalid, model.SignatureReasonDocModified, model.True
+	if report := signature_report([]*model.SignatureValidationResult{valid, &modified}); report.Authentic {
+		t.Errorf("signature_report() is authentic although the document was modified after signing")
+	}
+	if report := signature_report([]*model.SignatureValidationResult{unsigned}); report.Authentic {
+		t.Errorf("signature_report() is authentic without a signed signature")
+	}
+}
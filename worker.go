@@ -35,15 +35,16 @@ import (
 	"image/png"
 	"io"
 	"log"
+	"math"
 	"math/big"
 	"net"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -238,6 +239,65 @@ func FileSha512(file *os.File) (checksum string) {
 	return checksum
 }
 
+// copy_file copies the file at source to destination
+func copy_file(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	close_err := out.Close()
+	if err != nil {
+		return err
+	}
+	return close_err
+}
+
+// keep_sources copies the source files of a converted document into dir and returns their new paths
+func keep_sources(sources []string, dir string) ([]string, error) {
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(sources))
+	for _, source := range sources {
+		destination := filepath.Join(dir, filepath.Base(source))
+		if err := copy_file(source, destination); err != nil {
+			return kept, err
+		}
+		kept = append(kept, destination)
+	}
+	return kept, nil
+}
+
+// FileSha256 returns the SHA-256 checksum and the size in bytes of the file at path
+func FileSha256(path string) (checksum string, size int64, err error) {
+	sem_shafile.Acquire()
+	defer sem_shafile.Release()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err = io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+
+	checksum = hex.EncodeToString(hash.Sum(nil))
+	return checksum, size, nil
+}
+
 func cryptoRandInt(min, max int) (int, error) {
 	if min > max {
 		return 0, errors.New("invalid range")
@@ -263,8 +323,19 @@ func downloadFile(ctx context.Context, url string, output string) error {
 		}
 
 		var netErr net.Error
-		if errors.As(err, &netErr) && netErr.Timeout() {
-			wait, _ := cryptoRandInt(0, 1<<i)
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) && statusErr.Temporary() {
+			if statusErr.RetryAfter > time.Duration(*flag_i_max_retry_after)*time.Second {
+				log_error.Tracef("downloadFile gave up on %v because the server asked to wait %v", url, statusErr.RetryAfter)
+				break
+			}
+			if statusErr.RetryAfter > 0 {
+				continue // polite_request waits until the Retry-After has passed
+			}
+		}
+		if errors.Is(err, ErrDownloadIncomplete) || (errors.As(err, &netErr) && netErr.Timeout()) ||
+			(statusErr != nil && statusErr.Temporary()) {
+			wait, _ := cryptoRandInt(0, 1<<min(i, 8))
 			select {
 			case <-time.After(time.Duration(wait) * time.Second):
 				continue
@@ -283,25 +354,11 @@ func tryDownloadFile(ctx context.Context, url string, output string) error {
 	sem_download.Acquire()
 	defer sem_download.Release()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	err := download_to(ctx, http_client, url, output, int64(*flag_i_max_download_mb)<<20)
 	if err != nil {
-		return log_error.TraceReturn(err)
+		log_error.Tracef("failed to download %v to %v due to err %v", url, output, err)
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return log_error.TraceReturn(err)
-	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(output)
-	if err != nil {
-		return log_error.TraceReturn(err)
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return log_error.TraceReturn(err)
+	return err
 }
 
 func Sha256(in string) (checksum string) {
@@ -313,29 +370,27 @@ func Sha256(in string) (checksum string) {
 	return checksum
 }
 
-func resizePng(imgFile *os.File, newWidth int, outputFilename string) error {
+func resizePng(img image.Image, newWidth, newHeight int, outputFilename string) error {
 	sem_resize.Acquire()
 	defer sem_resize.Release()
 
-	if newWidth <= 0 {
-		return errors.New("invalid width provided")
-	}
-
-	// Decode the image using the imaging package
-	imgFile.Seek(0, 0) // Make sure the file pointer is at the beginning
-	img, err := imaging.Decode(imgFile)
-	if err != nil {
-		return err
+	if newWidth < 0 || newHeight < 0 || (newWidth == 0 && newHeight == 0) {
+		return errors.New("invalid width and height provided")
 	}
 
-	// Calculate the new height to maintain aspect ratio
+	// Calculate the missing side to maintain aspect ratio; with both sides the image fits inside the box
 	originalBounds := img.Bounds()
-	originalWidth := originalBounds.Dx()
-	originalHeight := originalBounds.Dy()
-	newHeight := int((float64(newWidth) / float64(originalWidth)) * float64(originalHeight))
+	originalWidth := float64(originalBounds.Dx())
+	originalHeight := float64(originalBounds.Dy())
+	scale := float64(newWidth) / originalWidth
+	if newWidth == 0 || (newHeight > 0 && float64(newHeight)/originalHeight < scale) {
+		scale = float64(newHeight) / originalHeight
+	}
+	width := max(1, int(originalWidth*scale))
+	height := max(1, int(originalHeight*scale))
 
 	// Resize the image using the bilinear interpolation
-	newImage := resize.Resize(uint(newWidth), uint(newHeight), img, resize.Bilinear)
+	newImage := resize.Resize(uint(width), uint(height), img, resize.Bilinear)
 
 	// Create the output file
 	outputFile, err := os.Create(outputFilename)
@@ -397,13 +452,13 @@ func resizeJpg(imgFile *os.File, newWidth int, outputFilename string) error {
 	return nil
 }
 
-func convertAndOptimizePNG(imgFile *os.File, outputFilename string) error {
+func convertAndOptimizePNG(imgFile *os.File, outputFilename string, quality int) error {
 	sem_png2jpg.Acquire()
 	defer sem_png2jpg.Release()
 
 	imgErr := validatePNGFile(imgFile)
 	if imgErr != nil {
-		log_error.Trace("convertAndOptimizePNG(imgFile)->validatePNGFile(imgFile) threw err: %+v", imgErr)
+		log_error.Tracef("convertAndOptimizePNG(imgFile)->validatePNGFile(imgFile) threw err: %+v", imgErr)
 		return imgErr
 	}
 
@@ -435,7 +490,7 @@ func convertAndOptimizePNG(imgFile *os.File, outputFilename string) error {
 	defer outputFile.Close()
 
 	err3 := jpeg.Encode(outputFile, img, &jpeg.EncoderOptions{
-		Quality:         *flag_g_jpg_quality,
+		Quality:         quality,
 		OptimizeCoding:  true,
 		ProgressiveMode: *flag_g_progressive_jpeg,
 	})
@@ -446,6 +501,78 @@ func convertAndOptimizePNG(imgFile *os.File, outputFilename string) error {
 	return nil
 }
 
+// ImageEncoder converts the PNG rendition of a page into one of the formats that the reader serves
+type ImageEncoder interface {
+	Format() string  // extension of the files that the encoder writes
+	Available() bool // false when the local encoder is not installed
+	Encode(pngFilename, outputFilename string, quality int) error
+}
+
+var m_image_encoders = map[string]ImageEncoder{
+	c_format_jpg:  jpegEncoder{},
+	c_format_webp: webpEncoder{},
+	c_format_avif: avifEncoder{},
+}
+
+// jpegEncoder writes optimized (and optionally progressive) JPEG files with go-libjpeg
+type jpegEncoder struct{}
+
+func (jpegEncoder) Format() string  { return c_format_jpg }
+func (jpegEncoder) Available() bool { return true }
+func (jpegEncoder) Encode(pngFilename, outputFilename string, quality int) error {
+	f, err := os.Open(pngFilename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return convertAndOptimizePNG(f, outputFilename, quality)
+}
+
+// webpEncoder writes lossy WebP files with the optional `cwebp` binary
+//
+//	cwebp -quiet -mt -q <quality> <png> -o <webp>
+type webpEncoder struct{}
+
+func (webpEncoder) Format() string  { return c_format_webp }
+func (webpEncoder) Available() bool { return len(m_optional_binaries["cwebp"]) > 0 }
+func (webpEncoder) Encode(pngFilename, outputFilename string, quality int) error {
+	sem_cwebp.Acquire()
+	defer sem_cwebp.Release()
+	return runEncoder(m_optional_binaries["cwebp"], outputFilename,
+		`-quiet`, `-mt`, `-q`, strconv.Itoa(quality), pngFilename, `-o`, outputFilename)
+}
+
+// avifEncoder writes AVIF files with the optional `avifenc` binary; quality 1-100 is mapped onto its 63-0 quantizer
+//
+//	avifenc --speed 6 --min <q> --max <q> <png> <avif>
+type avifEncoder struct{}
+
+func (avifEncoder) Format() string  { return c_format_avif }
+func (avifEncoder) Available() bool { return len(m_optional_binaries["avifenc"]) > 0 }
+func (avifEncoder) Encode(pngFilename, outputFilename string, quality int) error {
+	quantizer := strconv.Itoa(63 - int(math.Round(float64(quality)*63/100)))
+	sem_avifenc.Acquire()
+	defer sem_avifenc.Release()
+	return runEncoder(m_optional_binaries["avifenc"], outputFilename,
+		`--speed`, `6`, `--min`, quantizer, `--max`, quantizer, pngFilename, outputFilename)
+}
+
+// runEncoder executes an encoder binary and removes a partially written outputFilename when it fails
+func runEncoder(binary, outputFilename string, args ...string) error {
+	if len(binary) == 0 {
+		return fmt.Errorf("no encoder binary is installed to write %v", outputFilename)
+	}
+	cmd := exec.Command(binary, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		_ = os.Remove(outputFilename)
+		return fmt.Errorf("failed to execute `%v %v` due to error: %v\n\tSTDERR = %v", filepath.Base(binary), strings.Join(args, " "), err, stderr.String())
+	}
+	return nil
+}
+
 /*
 A little bot named Red lived in Paint Town. Red loved to help kids make their pictures look pretty!
 One day, tiny Tim brought a clear sheet with colors on it. "I want to show my friends!" said Tim.
@@ -685,46 +812,107 @@ func colorDistance(c1, c2 color.Color) uint64 {
 	return uint64(dr*dr + dg*dg + db*db)
 }
 
-func ConvertToDarkMode(img *os.File, directory, outputFilename string) (*os.File, error) {
+// ConvertToDarkMode maps every unsaturated pixel of src along a smooth luminance curve through the colour stops of
+// palette, from black ink (palette[0]) to white paper (the last stop), instead of swapping two fuzzy colour ranges;
+// anti-aliased text edges and gray stamps land on the stops in between. Pixels whose saturation reaches
+// --dark-saturation (colour photos, highlighter, seals) keep their colour, and pixels approaching that saturation are
+// blended so photos do not get a hard outline. The alpha of every pixel is kept.
+func ConvertToDarkMode(src image.Image, palette []color.RGBA) *image.NRGBA {
 	sem_darkimage.Acquire()
 	defer sem_darkimage.Release()
-	img.Seek(0, 0)
-	srcImage, _, err := image.Decode(img)
-	if err != nil {
-		return img, err
-	}
-	dstImage := image.NewRGBA(srcImage.Bounds())
-	// Iterate over all pixels in the image and apply the dark mode colors
-	for y := dstImage.Bounds().Min.Y; y < dstImage.Bounds().Max.Y; y++ {
-		for x := dstImage.Bounds().Min.X; x < dstImage.Bounds().Max.X; x++ {
-			srcPixel := srcImage.At(x, y)
-
-			if colorDistance(srcPixel, color.Black) <= uint64(0x050505)*uint64(0x050505) {
-				dstImage.Set(x, y, color_text)
-			} else if colorDistance(srcPixel, color.White) <= uint64(0x0F0F0F)*uint64(0x0F0F0F) {
-				dstImage.Set(x, y, color_background)
-			} else {
-				dstImage.Set(x, y, srcPixel)
-			}
 
+	dst := imaging.Clone(src)
+	if len(palette) == 0 {
+		return dst
+	}
+	threshold := *flag_f_dark_saturation
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		r, g, b := float64(dst.Pix[i]), float64(dst.Pix[i+1]), float64(dst.Pix[i+2])
+
+		luminance := (0.299*r + 0.587*g + 0.114*b) / 255
+		dr, dg, db := paletteColor(palette, smoothstep(c_dark_ink_level, c_dark_paper_level, luminance))
+
+		high, low := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+		var saturation float64
+		if high > 0 {
+			saturation = (high - low) / high
+		}
+		keep := 0.0
+		if threshold > 0 {
+			keep = smoothstep(threshold/2, threshold, saturation)
 		}
+
+		dst.Pix[i] = uint8(math.Round(dr + (r-dr)*keep))
+		dst.Pix[i+1] = uint8(math.Round(dg + (g-dg)*keep))
+		dst.Pix[i+2] = uint8(math.Round(db + (b-db)*keep))
 	}
-	tempFile, err := os.CreateTemp(directory, outputFilename)
-	if err != nil {
-		return img, err
+	return dst
+}
+
+// paletteColor interpolates the colour at level (0.0 ink - 1.0 paper) between the evenly spaced stops of palette
+func paletteColor(palette []color.RGBA, level float64) (r, g, b float64) {
+	if len(palette) == 1 {
+		return float64(palette[0].R), float64(palette[0].G), float64(palette[0].B)
+	}
+	position := math.Min(math.Max(level, 0), 1) * float64(len(palette)-1)
+	stop := int(position)
+	if stop >= len(palette)-1 {
+		stop = len(palette) - 2
+	}
+	t := position - float64(stop)
+	from, to := palette[stop], palette[stop+1]
+	r = float64(from.R) + (float64(to.R)-float64(from.R))*t
+	g = float64(from.G) + (float64(to.G)-float64(from.G))*t
+	b = float64(from.B) + (float64(to.B)-float64(from.B))*t
+	return r, g, b
+}
+
+// smoothstep is 0 below edge0, 1 above edge1 and eases between them
+func smoothstep(edge0, edge1, x float64) float64 {
+	if edge1 <= edge0 {
+		if x < edge0 {
+			return 0
+		}
+		return 1
 	}
-	err = jpeg.Encode(tempFile, dstImage, &jpeg.EncoderOptions{
-		Quality:         jpeg_compression_ratio,
-		OptimizeCoding:  true,
-		ProgressiveMode: true,
-	})
-	if err != nil {
-		tempFile.Close()
-		os.Remove(tempFile.Name()) // Delete the temp file in case of error
-		return img, err
+	t := math.Min(math.Max((x-edge0)/(edge1-edge0), 0), 1)
+	return t * t * (3 - 2*t)
+}
+
+// parseRGB parses a "R,G,B" string of 0-255 values such as --dark-foreground into an opaque color.RGBA
+func parseRGB(in string) (color.RGBA, error) {
+	parts := strings.Split(strings.ReplaceAll(in, " ", ""), ",")
+	if len(parts) != 3 {
+		return color.RGBA{}, fmt.Errorf("expected R,G,B but got %q", in)
+	}
+	var rgb [3]uint8
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("invalid colour component %q in %q: %v", part, in, err)
+		}
+		rgb[i] = uint8(value)
+	}
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}, nil
+}
+
+// parsePalette parses the semicolon separated "R,G,B" colour stops of --dark-palette
+func parsePalette(in string) ([]color.RGBA, error) {
+	var palette []color.RGBA
+	for _, stop := range strings.Split(in, ";") {
+		if len(strings.TrimSpace(stop)) == 0 {
+			continue
+		}
+		rgb, err := parseRGB(stop)
+		if err != nil {
+			return nil, err
+		}
+		palette = append(palette, rgb)
 	}
-	tempFile.Seek(0, 0)
-	return tempFile, nil
+	if len(palette) < 2 {
+		return nil, fmt.Errorf("expected at least two R,G,B colour stops separated by ; but got %q", in)
+	}
+	return palette, nil
 }
 
 func verifyBinaries(binaries []string) error {
@@ -751,6 +939,26 @@ func verifyBinaries(binaries []string) error {
 	return nil
 }
 
+// findOptionalBinaries records the binaries that are installed into m_optional_binaries; the features that depend
+// on a missing binary are skipped instead of stopping the writer
+func findOptionalBinaries(binaries []string) {
+	for _, binary := range binaries {
+		if runtime.GOOS == "windows" {
+			binary += ".exe"
+		}
+
+		path, err := exec.LookPath(binary)
+		if err != nil || checkIfExecutable(path) != nil {
+			log.Printf("optional binary '%s' is not installed", binary)
+			continue
+		}
+
+		m_optional_binaries[strings.TrimSuffix(binary, ".exe")] = path
+
+		log.Printf("optional binary '%s' exists and is executable at path: %v", binary, path)
+	}
+}
+
 func DirHasPDFs(dirname string) (bool, error) {
 	f, err := os.Open(dirname)
 	if err != nil {
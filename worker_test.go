@@ -0,0 +1,81 @@
+/*
+Project Apario is the World's Truth Repository that was invented and started by Andrei Merlescu in 2020.
+Copyright (C) 2023  Andrei Merlescu
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func Test_ConvertToDarkMode(t *testing.T) {
+	foreground := color.RGBA{R: 250, G: 226, B: 203, A: 255}
+	middle := color.RGBA{R: 140, G: 140, B: 170, A: 255}
+	background := color.RGBA{R: 40, G: 40, B: 86, A: 255}
+
+	src := image.NewNRGBA(image.Rect(0, 0, 5, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{A: 255})                         // black ink
+	src.SetNRGBA(1, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255}) // white paper
+	src.SetNRGBA(2, 0, color.NRGBA{R: 220, G: 30, B: 40, A: 255})   // red seal
+	src.SetNRGBA(3, 0, color.NRGBA{R: 140, G: 140, B: 140, A: 255}) // gray stamp halfway between ink and paper
+	src.SetNRGBA(4, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 96})  // translucent paper
+
+	near := func(got color.NRGBA, want color.RGBA) bool {
+		d := func(a, b uint8) int {
+			if a > b {
+				return int(a - b)
+			}
+			return int(b - a)
+		}
+		return d(got.R, want.R) <= 3 && d(got.G, want.G) <= 3 && d(got.B, want.B) <= 3
+	}
+
+	dark := ConvertToDarkMode(src, []color.RGBA{foreground, background})
+	if got := dark.NRGBAAt(0, 0); !near(got, foreground) {
+		t.Errorf("black ink = %v, want the foreground %v", got, foreground)
+	}
+	if got := dark.NRGBAAt(1, 0); !near(got, background) {
+		t.Errorf("white paper = %v, want the background %v", got, background)
+	}
+	if got := dark.NRGBAAt(2, 0); got != (color.NRGBA{R: 220, G: 30, B: 40, A: 255}) {
+		t.Errorf("red seal = %v, want its colour kept", got)
+	}
+	if got := dark.NRGBAAt(4, 0); got.A != 96 || !near(got, background) {
+		t.Errorf("translucent paper = %v, want the background with its alpha of 96", got)
+	}
+
+	dark = ConvertToDarkMode(src, []color.RGBA{foreground, middle, background})
+	if got := dark.NRGBAAt(3, 0); !near(got, middle) {
+		t.Errorf("gray stamp with a three colour palette = %v, want the middle stop %v", got, middle)
+	}
+	if got := dark.NRGBAAt(0, 0); !near(got, foreground) {
+		t.Errorf("black ink with a three colour palette = %v, want the foreground %v", got, foreground)
+	}
+}
+
+func Test_parsePalette(t *testing.T) {
+	palette, err := parsePalette("250,226,203; 140,140,170 ;40,40,86")
+	if err != nil || len(palette) != 3 || palette[1] != (color.RGBA{R: 140, G: 140, B: 170, A: 255}) {
+		t.Errorf("parsePalette() = %v, %v", palette, err)
+	}
+	for _, invalid := range []string{"250,226,203", "250,226,203;40,40", "250,226,203;40,40,860", ""} {
+		if _, err := parsePalette(invalid); err == nil {
+			t.Errorf("parsePalette(%q) accepted an invalid palette", invalid)
+		}
+	}
+}